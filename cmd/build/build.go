@@ -9,9 +9,11 @@ import (
 	"github.com/nostalgist134/FuzzGIUPluginKit/goParser"
 	"github.com/nostalgist134/FuzzGIUPluginKit/tmpl"
 	"github.com/spf13/cobra"
+	"go/format"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -28,6 +30,64 @@ func init() {
 	Cmd.Flags().StringP("usage-file", "u", "", "usage file to be used for PluginInfo")
 	Cmd.Flags().BoolP("no-clean", "k", false, "keep intermediate files")
 	Cmd.Flags().BoolP("info", "i", false, "generate PluginInfo function for plugin")
+	Cmd.Flags().BoolP("yes", "y", false, "continue building without asking when go mod tidy fails")
+	Cmd.Flags().Bool("strict", false, "stop building without asking when go mod tidy fails")
+	Cmd.Flags().Bool("no-tidy", false, "skip go mod tidy")
+	Cmd.Flags().Bool("no-recover", false, "don't recover from panics in the plugin function")
+	// 指定插件的调用方式，在linux/macOS上以cgo方式编译windows上使用的插件，可以通过test run --abi cgo测试
+	Cmd.Flags().String("abi", "", "plugin ABI, cgo or plugin (default: cgo on windows, plugin otherwise)")
+}
+
+// getABI 返回编译使用的调用方式，在非windows系统上使用cgo方式时改为c-shared编译
+func getABI(cmd *cobra.Command, env1 *env.Env) string {
+	abi, _ := cmd.Flags().GetString("abi")
+	switch abi {
+	case "":
+		return convention.ABIOf(env1.OS)
+	case convention.ABICgo:
+		if env1.OS != "windows" {
+			env1.UseCShared()
+		}
+	case convention.ABIPlugin:
+		if env1.OS == "windows" {
+			common.FailExit("go plugins are not supported on windows")
+		}
+	default:
+		common.FailExit(fmt.Sprintf("unknown ABI %s, expect %s or %s", abi, convention.ABICgo, convention.ABIPlugin))
+	}
+	return abi
+}
+
+// tidyPolicy 决定go mod tidy失败时的行为
+type tidyPolicy struct {
+	skip   bool // 不执行go mod tidy
+	yes    bool // 失败时继续编译
+	strict bool // 失败时停止编译
+}
+
+func getTidyPolicy(cmd *cobra.Command) tidyPolicy {
+	tp := tidyPolicy{}
+	tp.skip, _ = cmd.Flags().GetBool("no-tidy")
+	tp.yes, _ = cmd.Flags().GetBool("yes")
+	tp.strict, _ = cmd.Flags().GetBool("strict")
+	if tp.yes && tp.strict {
+		common.FailExit("--yes and --strict are mutually exclusive")
+	}
+	return tp
+}
+
+// continueAfterTidyFail 根据策略决定go mod tidy失败后是否继续，未指定策略且无法询问用户时停止编译
+func (tp tidyPolicy) continueAfterTidyFail() bool {
+	switch {
+	case tp.strict:
+		return false
+	case tp.yes:
+		return true
+	case !common.IsInteractive():
+		fmt.Println("go mod tidy failed and stdin is not interactive, use --yes to continue building anyway")
+		return false
+	}
+	return common.GetUserYN("go mod tidy failed, continue building anyway?")
 }
 
 func exclusiveImports(imp []string, imp1 []string) []string {
@@ -62,33 +122,58 @@ func getImpStr(imports []string) string {
 	return sb.String()
 }
 
-func buildSharedLib(goPath string, src string, out string, env1 env.Env, funInfo *convention.FuncDecl) string {
-	// go mod tidy
-	fmt.Printf("> %s mod tidy\n", goPath)
-	c := exec.Command(goPath, "mod", "tidy")
-	output, err := c.CombinedOutput()
-	if len(output) > 0 {
-		fmt.Println(string(output))
+// prepareModFile 将go.mod与go.sum复制到工作区，编译时通过-modfile使用副本，go mod tidy也只会修改副本
+func prepareModFile(ws *env.Workspace, srcDir string) (string, error) {
+	modRoot := env.FindModRoot(srcDir)
+	if modRoot == "" {
+		return "", nil
 	}
+	modFile, err := ws.CopyIn(filepath.Join(modRoot, "go.mod"), "go.mod")
 	if err != nil {
-		buf := make([]byte, 1)
-		fmt.Print("go mod tidy failed, continue building anyway?(Y/N)")
-		os.Stdin.Read(buf)
-		if buf[0] != 'Y' && buf[0] != 'y' {
+		return "", err
+	}
+	if _, err = os.Stat(filepath.Join(modRoot, "go.sum")); err == nil {
+		_, err = ws.CopyIn(filepath.Join(modRoot, "go.sum"), "go.sum")
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	return modFile, err
+}
+
+// prepareModule 准备编译使用的go.mod副本并对其执行go mod tidy，返回副本路径（源码不在模块中时为空）
+func prepareModule(goPath string, ws *env.Workspace, srcDir string, tp tidyPolicy) string {
+	modFile, err := prepareModFile(ws, srcDir)
+	common.FailExit(err)
+	if modFile != "" && tp.skip {
+		fmt.Println("skip go mod tidy")
+	} else if modFile != "" {
+		// go mod tidy
+		fmt.Printf("> %s mod tidy -modfile=%s\n", goPath, modFile)
+		c := exec.Command(goPath, "mod", "tidy", "-modfile="+modFile)
+		c.Dir = srcDir
+		output, err := c.CombinedOutput()
+		if len(output) > 0 {
+			fmt.Println(string(output))
+		}
+		if err != nil && !tp.continueAfterTidyFail() {
 			common.FailExit(err)
 		}
 	}
+	return modFile
+}
 
-	// go fmt
-	fmt.Printf("> %s fmt wrapped.go\n", goPath)
-	c = exec.Command(goPath, "fmt", "wrapped.go")
-	output, _ = c.CombinedOutput()
-	if len(output) > 0 {
-		fmt.Print(string(output))
+func buildSharedLib(goPath string, ws *env.Workspace, srcDir string, out string, env1 env.Env,
+	funInfo *convention.FuncDecl, lm *lineMap, modFile string) string {
+	ovFile, err := ws.WriteOverlay()
+	common.FailExit(err)
+	flags := []string{"-overlay=" + ovFile}
+	if modFile != "" {
+		flags = append(flags, "-modfile="+modFile)
 	}
 
-	// go build ...
-	buildArgs := env.GetBuildArgs(env1, out, src)
+	// go build ...，编译产物先输出到工作区（windows下生成的.h文件也会留在工作区中）
+	wsOut := ws.Path(filepath.Base(out))
+	buildArgs := env.GetBuildArgs(env1, wsOut, ".", flags...)
 
 	fmt.Printf("> %s ", goPath)
 	for _, a := range buildArgs {
@@ -100,26 +185,22 @@ func buildSharedLib(goPath string, src string, out string, env1 env.Env, funInfo
 	}
 	os.Stdout.Write([]byte{'\n'})
 
-	common.SetExitDefer(func() { os.Remove("wrapped.go") })
-	c = exec.Command(goPath, buildArgs...)
-	output, err = c.CombinedOutput()
+	c := exec.Command(goPath, buildArgs...)
+	c.Dir = srcDir
+	output, err := c.CombinedOutput()
 	if len(output) > 0 {
-		fmt.Print(string(output))
+		// 编译输出中指向wrapped.go的位置换回源文件的位置
+		fmt.Print(lm.rewrite(string(output)))
 	}
 	common.FailExit(err)
 
-	out, _ = filepath.Abs(out)
+	common.FailExit(env.CopyFile(wsOut, out))
 	fmt.Printf("successfully built %s, parameters: %v\n", out, funInfo.Params)
 	return out
 }
 
 func runCmdBuild(cmd *cobra.Command, _ []string) {
 	common.SetCurrentCmd(cmd.Use)
-	cwd := env.GetCwd()
-	common.SetExitDefer(func() {
-		os.Chdir(cwd)
-	})
-	defer os.Chdir(cwd)
 
 	goPath, _ := cmd.Flags().GetString("go-path")
 	if goPath == "" {
@@ -128,10 +209,11 @@ func runCmdBuild(cmd *cobra.Command, _ []string) {
 
 	// 检查构建环境
 	env1 := env.Check(goPath)
+	abi := getABI(cmd, &env1)
 	if env1.OkToBuild == false {
 		common.FailExit("environment check failed")
 	}
-	fmt.Printf("currently build under %s, using go version %s\n", env1.OS, env1.GoVersion)
+	fmt.Printf("currently build under %s, using go version %s, ABI %s\n", env1.OS, env1.GoVersion, abi)
 
 	// 检查路径
 	path, err := cmd.Flags().GetString("path")
@@ -139,119 +221,267 @@ func runCmdBuild(cmd *cobra.Command, _ []string) {
 	if path == "" {
 		common.FailExit("missing build path/file")
 	}
-	pluginFile := path
 	stat, err := os.Stat(path)
 	common.FailExit(err)
-	if stat.IsDir() {
-		pluginFile = filepath.Join(pluginFile, "main.go")
-	}
-
-	// 寻找插件函数
-	var fd *convention.FuncDecl
-	var paraMeta []convention.ParaMeta
-	pType := ""
-	pFun := ""
-	for _, pFun = range convention.PluginFunNames {
-		fd, paraMeta, err = goParser.FindFunction(pluginFile, pFun)
-		if os.IsNotExist(err) {
-			continue
-		}
+	// 目录则收集整个包的源文件，单个文件则只使用该文件，同目录下的其它文件不参与编译
+	srcDir := path
+	if !stat.IsDir() {
+		srcDir = filepath.Dir(path)
+	}
+	srcDir, err = filepath.Abs(srcDir)
+	common.FailExit(err)
+	allFiles, err := goParser.PackageFiles(srcDir, "wrapped.go")
+	if err != nil && stat.IsDir() {
 		common.FailExit(err)
-		pType = convention.GetPluginType(pFun)
-		break
 	}
-	if os.IsNotExist(err) || fd == nil {
-		common.FailExit("cannot find supported plugin function")
+	pkgFiles := allFiles
+	if !stat.IsDir() {
+		absPath, _ := filepath.Abs(path)
+		pkgFiles = []string{absPath}
 	}
 
-	// 检查插件函数是否符合约定
+	// 在包内所有文件中寻找插件函数，有多个时由//fgpk:type指令决定
+	entry, err := common.ResolvePluginEntry(pkgFiles)
+	common.FailExit(err)
+	fd, paraMeta, pType, pFun, pluginFile := entry.Fd, entry.ParaMeta, entry.Type, entry.FunName, entry.File
+	fmt.Printf("plugin function %s found in %s\n", pFun, filepath.Base(pluginFile))
+
+	// 检查插件函数是否符合约定，与次要插件函数的问题一起报告，自定义参数能使用的类型取决于调用方式
 	fmt.Printf("plugin type - %s\n", pType)
-	ok, msg := convention.CheckPluginFun(pType, *fd)
-	if !ok {
-		common.FailExit(fmt.Sprintf("plugin function check failed: %s", msg))
+	sigErrs := make([]error, 0)
+	if err = convention.CheckPluginFun(abi, pType, *fd); err != nil {
+		sigErrs = append(sigErrs, err)
+	}
+
+	// 读取源码中的fgpk指令（插件版本、要求的FuzzGIU版本等）
+	pi := convention.PluginInfo{Type: pType, GoVersion: env1.GoVersion, Params: paraMeta}
+	common.FailExit(common.ApplyDirectives(&pi, pkgFiles))
+	if pi.Version != "" {
+		fmt.Printf("plugin version - %s\n", pi.Version)
+	}
+	if err = common.CheckRequires(&pi); err != nil {
+		fmt.Printf("warning: %v\n", err)
 	}
 
 	// 寻找次要插件函数，并检查是否遵循约定
 	var (
 		minorFuncExist bool
 		minorFun       string
+		fd2            *convention.FuncDecl
 	)
 	if pType == convention.PluginTypes[convention.IndPTypeIterator] { // 目前只有iterator可能有次要函数，所以暂时先if判断了
-		var fd2 *convention.FuncDecl
 		minorFun = convention.PluginMinorFun[0]
-		fd2, _, err = goParser.FindFunction(pluginFile, minorFun)
+		fd2, _, _, err = goParser.FindFunctionInFiles(pkgFiles, minorFun)
 		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			common.FailExit(err)
 		} else if errors.Is(err, os.ErrNotExist) {
 			minorFuncExist = false
 		} else {
 			minorFuncExist = true
-			ok, msg = convention.CheckPluginMinorFunc(pType, *fd2)
-			if !ok {
-				common.FailExit(fmt.Sprintf("plugin function check failed: %s", msg))
+			if err = convention.CheckPluginMinorFunc(abi, pType, minorFun, *fd2, *fd); err != nil {
+				sigErrs = append(sigErrs, err)
 			}
 		}
 	}
 
-	wrapped, err := tmpl.GetTemplate(env1.OS, pType)
-	common.FailExit(err)
+	// 寻找生命周期函数Init与Close，只定义了其中一个时，另一个在包装代码中生成默认的空实现
+	hooks := make([]string, 0)
+	hookFds := make([]checkedFunc, 0)
+	for _, hook := range convention.PluginMinorFun[convention.IndInitMinor:] {
+		fdHook, _, _, err := goParser.FindFunctionInFiles(pkgFiles, hook)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		common.FailExit(err)
+		if err = convention.CheckPluginMinorFunc(abi, pType, hook, *fdHook, *fd); err != nil {
+			sigErrs = append(sigErrs, err)
+		}
+		hooks = append(hooks, hook)
+		hookFds = append(hookFds, checkedFunc{hook, fdHook})
+	}
+	defaultHooks := make([]string, 0)
+	if len(hooks) > 0 {
+		fmt.Printf("lifecycle hooks - %s\n", strings.Join(hooks, ", "))
+		for _, hook := range convention.PluginMinorFun[convention.IndInitMinor:] {
+			if !slices.Contains(hooks, hook) {
+				defaultHooks = append(defaultHooks, hook)
+			}
+		}
+	}
+	if len(sigErrs) > 0 {
+		for _, e := range sigErrs {
+			fmt.Println(e)
+		}
+		common.FailExit("plugin function check failed")
+	}
 
-	if pType == convention.PluginTypes[convention.IndPTypeIterator] && !minorFuncExist {
-		wrapped += "\n" + convention.DefMinorFun(pType)
+	pi.Hooks = hooks
+	pi.ReturnsError = convention.ReturnsError(pType, *fd)
+
+	// 创建工作区，wrapped.go等中间文件均写入工作区
+	ws, err := env.NewWorkspace()
+	common.FailExit(err)
+	noClean, _ := cmd.Flags().GetBool("no-clean")
+	cleanWorkspace := func() {
+		if noClean {
+			fmt.Printf("intermediate files are kept in %s\n", ws.Dir)
+			return
+		}
+		if err := ws.Remove(); err != nil {
+			fmt.Printf("remove workspace %s failed: %v\n", ws.Dir, err)
+		}
 	}
+	common.SetExitDefer(cleanWorkspace)
+	defer cleanWorkspace()
+	common.ExitOnInterrupt()
 
-	// 替换模板中的函数名占位符
-	wrapped = tmpl.Replace(wrapped, tmpl.PHFunName, pFun)
-	wrapped = tmpl.Replace(wrapped, tmpl.PHMinorFunName, minorFun)
+	// go.mod副本在类型检查与生成PluginInfo之前准备好，两者使用的依赖才与编译时一致
+	modFile := prepareModule(goPath, ws, srcDir, getTidyPolicy(cmd))
 
-	// 替换模板中去重的import语句
-	tempImports, _ := goParser.GetImports(wrapped, true)
-	srcImports, _ := goParser.GetImports(pluginFile)
-	eImports := exclusiveImports(srcImports, tempImports)
-	wrapped = tmpl.Replace(wrapped, tmpl.PHCustomImports, getImpStr(eImports))
+	tempSrc, err := tmpl.GetTemplate(abi, pType)
+	common.FailExit(err)
+	tempImports, _ := goParser.GetImports(tempSrc, true)
 
-	// 替换形参与实参列表
-	formal, actual := convention.GetParamStrings(env1.OS, pType, fd.Params)
-	wrapped = tmpl.Replace(wrapped, tmpl.PHFormalPara, formal)
-	wrapped = tmpl.Replace(wrapped, tmpl.PHActualPara, actual)
+	// 追加包装代码使用的辅助函数：plugin方式下有自定义参数时需要转换参数类型，捕获panic时需要将其转换为错误，
+	// 定义了生命周期函数时需要缓存Init的调用，辅助函数的import之后与源码的import一起合并到模板中
+	params := convention.GetCustomParams(pType, fd.Params)
+	noRecover, _ := cmd.Flags().GetBool("no-recover")
+	helpers := make([]string, 0)
+	if abi == convention.ABIPlugin && len(params) > 0 {
+		helpers = append(helpers, "argCoerce")
+	}
+	if !noRecover {
+		helpers = append(helpers, "recover")
+	}
+	if len(hooks) > 0 {
+		helpers = append(helpers, "lifecycle")
+	}
+	helperImports := make([]string, 0)
+	helperSyms := make([]string, 0)
+	appended := ""
+	for _, h := range helpers {
+		helper, err := tmpl.RenderHelper(abi, h)
+		common.FailExit(err)
+		imports, code, err := goParser.SplitImports(helper)
+		common.FailExit(err)
+		names, err := goParser.DeclaredNames(helper)
+		common.FailExit(err)
+		helperImports = append(helperImports, exclusiveImports(imports, append(tempImports, helperImports...))...)
+		helperSyms = append(helperSyms, names...)
+		appended += "\n" + code
+	}
 
-	// 将code占位符替换为源码
-	code, err := goParser.GetCode(pluginFile)
-	if !minorFuncExist && pType == convention.PluginTypes[convention.IndPTypeIterator] {
-		code += ""
+	// 使用go/types检查插件包，类型错误以及与生成的符号冲突的声明在编译wrapped.go之前报告
+	genPi, _ := cmd.Flags().GetBool("info")
+	checked := []checkedFunc{{pFun, fd}}
+	if fd2 != nil {
+		checked = append(checked, checkedFunc{minorFun, fd2})
 	}
+	checked = append(checked, hookFds...)
+	wrapperImports, err := goParser.ImportNames("package main\n" + getImpStr(append(tempImports, helperImports...)))
 	common.FailExit(err)
-	wrapped = tmpl.Replace(wrapped, tmpl.PHCode, code)
+	diags, err := validatePackage(srcDir, pkgFiles, modFile, pluginFile, checked,
+		generatedSymbols(pType, genPi, minorFuncExist, helperSyms, defaultHooks), wrapperImports)
+	common.FailExit(err)
+	if len(diags) > 0 {
+		for _, d := range diags {
+			fmt.Println(d)
+		}
+		common.FailExit("type check failed")
+	}
+
+	if pType == convention.PluginTypes[convention.IndPTypeIterator] && !minorFuncExist {
+		appended += "\n" + convention.DefMinorFun(minorFun, params)
+	}
+	for _, hook := range defaultHooks {
+		appended += "\n" + convention.DefMinorFun(hook, params)
+	}
 
-	// 输出文件名
+	// 渲染包装代码模板，模板中去重的import语句包括插件源码与辅助函数的import，插件源码的位置暂时留下标记
+	srcImports, _ := goParser.GetImports(pluginFile)
+	eImports := exclusiveImports(srcImports, tempImports)
+	eImports = append(eImports, exclusiveImports(helperImports, srcImports)...)
+	wrapped, err := tmpl.RenderWrapper(abi, pType, tmpl.Wrapper{
+		FunName:      pFun,
+		MinorFunName: minorFun,
+		Imports:      eImports,
+		Params:       params,
+		Recover:      !noRecover, // 捕获插件函数的panic，避免一个插件的panic导致整个FuzzGIU退出
+		Init:         len(hooks) > 0,
+		RetErr:       pi.ReturnsError,
+		Code:         tmpl.CodeMarker,
+	})
+	if err != nil {
+		common.FailExit(fmt.Sprintf("render wrapper template failed - %v", err))
+	}
+	wrapped += appended
+
+	// 输出文件名，相对路径相对于插件源码目录
 	out, _ := cmd.Flags().GetString("out")
 	if out == "" {
 		out = "FuzzGIU" + convention.GetPluginFunName(pType) + env1.BinSuffix
 	}
+	if !filepath.IsAbs(out) {
+		out = filepath.Join(srcDir, out)
+	}
 	fmt.Printf("out file: %s\n", out)
 
 	// 根据需要生成PluginInfo函数
-	if genPi, _ := cmd.Flags().GetBool("info"); genPi {
+	if genPi {
 		usageFile, _ := cmd.Flags().GetString("usage-file")
-		wrapped += "\n" + convention.GenPlugInfoFun(filepath.Base(out), pType, env1.GoVersion, usageFile, paraMeta)
+		pi.Name = filepath.Base(out)
+		pi.Build = collectProvenance(goPath, srcDir, modFile, pkgFiles)
+		wrapped += "\n" + convention.GenPlugInfoFun(abi, pi, usageFile)
 	}
 
-	// 进入项目目录，创建并写入文件
-	err = os.Chdir(filepath.Dir(pluginFile))
-	common.FailExit(err)
+	// 在粘贴源码之前格式化，使源码保持原样，//line指令的行号才能对得上
+	if formatted, err := format.Source([]byte(wrapped)); err != nil {
+		fmt.Printf("format wrapped.go failed - %v, keep it unformatted\n", err)
+	} else {
+		wrapped = string(formatted)
+	}
 
-	f, err := os.Create("wrapped.go")
+	// 将code占位符替换为带有//line指令的源码，源码之后的部分重新指回wrapped.go
+	wrapperPath := ws.Path("wrapped.go")
+	code, err := goParser.GetCodeWithLines(pluginFile)
+	common.FailExit(err)
+	wrapped, err = tmpl.PasteCode(wrapped, code+lineResetDirective(wrapperPath)+"\n")
+	common.FailExit(err)
+	wrapped, lm := resolveLineDirectives(wrapped, wrapperPath)
+	_, err = ws.WriteFile("wrapped.go", []byte(wrapped))
 	common.FailExit(err)
-	defer f.Close()
 
-	_, err = f.WriteString(wrapped)
+	// 插件包已通过检查，渲染后的包装代码仍有类型错误说明模板本身有问题，在编译之前报告
+	wrapperFiles := []string{wrapperPath}
+	for _, f := range pkgFiles {
+		if f != pluginFile {
+			wrapperFiles = append(wrapperFiles, f)
+		}
+	}
+	diags, err = validateWrapper(srcDir, wrapperFiles, modFile)
 	common.FailExit(err)
+	if len(diags) > 0 {
+		for _, d := range diags {
+			fmt.Println(d)
+		}
+		if !noClean {
+			fmt.Println("use -k to keep wrapped.go for inspection")
+		}
+		common.FailExit("generated wrapper failed to type-check")
+	}
 
-	// 编译文件
-	buildSharedLib(goPath, f.Name(), out, env1, fd)
-	// 决定是否保留中间文件
-	if noClean, _ := cmd.Flags().GetBool("no-clean"); !noClean {
-		f.Close()
-		defer env.RemoveIntermediateFiles(env1, out)
+	// 编译时插件函数所在的文件被忽略，由源码目录下的wrapped.go（实际内容在工作区中）代替，不参与编译的文件也被忽略。
+	// wrapped.go不能覆盖到插件函数所在的文件上：go build会为覆盖的文件加上-trimpath，把wrapped.go中的位置都改成
+	// 插件函数所在文件的名字，包装代码的编译错误与栈回溯就会指向插件源码中不存在的行
+	ws.Overlay(pluginFile, "")
+	for _, f := range allFiles {
+		if !slices.Contains(pkgFiles, f) {
+			ws.Overlay(f, "")
+		}
 	}
+	// 之前版本遗留在源码目录中的wrapped.go同样被代替
+	ws.Overlay(filepath.Join(srcDir, "wrapped.go"), wrapperPath)
+
+	// 编译文件
+	buildSharedLib(goPath, ws, srcDir, out, env1, fd, lm, modFile)
 }
@@ -0,0 +1,97 @@
+package build
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const lineDirective = "//line "
+
+// srcPos 原始文件中的位置
+type srcPos struct {
+	file string
+	line int
+}
+
+// lineMap 记录wrapped.go中每一行对应的原始文件位置
+type lineMap struct {
+	wrapper string
+	lines   []srcPos // 下标为wrapped.go的行号-1
+}
+
+// wrapperPosRegex 匹配输出中wrapped.go的位置，路径可能带有windows盘符（C:\...\wrapped.go:12）
+var wrapperPosRegex = regexp.MustCompile(`(?:(?:[A-Za-z]:)?[^\s:]*[/\\])?wrapped\.go:(\d+)(?::(\d+))?`)
+
+// lineResetDirective 返回一个不带行号的//line指令，resolveLineDirectives会将其补全为指回wrapper自身的指令
+func lineResetDirective(wrapper string) string {
+	return lineDirective + wrapper
+}
+
+// parseLineDirective 解析"//line file:line[:col]"，文件名中可能包含冒号（windows盘符），所以从后往前分割
+func parseLineDirective(l string) (srcPos, bool) {
+	body := strings.TrimPrefix(l, lineDirective)
+	ind := strings.LastIndex(body, ":")
+	if ind == -1 {
+		return srcPos{}, false
+	}
+	// 带有列号时，再向前找一个冒号
+	if _, err := strconv.Atoi(body[ind+1:]); err == nil {
+		if ind2 := strings.LastIndex(body[:ind], ":"); ind2 != -1 {
+			if _, err = strconv.Atoi(body[ind2+1 : ind]); err == nil {
+				body, ind = body[:ind], ind2
+			}
+		}
+	}
+	n, err := strconv.Atoi(body[ind+1:])
+	if err != nil {
+		return srcPos{}, false
+	}
+	return srcPos{file: body[:ind], line: n}, true
+}
+
+// resolveLineDirectives 将代码中指回wrapper的//line指令补全行号，并根据所有//line指令建立行号映射
+func resolveLineDirectives(code string, wrapper string) (string, *lineMap) {
+	lines := strings.Split(code, "\n")
+	lm := &lineMap{wrapper: wrapper, lines: make([]srcPos, len(lines))}
+	cur := srcPos{file: wrapper, line: 1}
+	reset := lineResetDirective(wrapper)
+	for i, l := range lines {
+		lm.lines[i] = cur
+		cur.line++
+		if !strings.HasPrefix(l, lineDirective) {
+			continue
+		}
+		if l == reset {
+			// 下一行在wrapped.go中的实际行号
+			lines[i] = fmt.Sprintf("%s:%d:1", reset, i+2)
+			cur = srcPos{file: wrapper, line: i + 2}
+		} else if pos, ok := parseLineDirective(l); ok {
+			cur = pos
+		}
+	}
+	return strings.Join(lines, "\n"), lm
+}
+
+// rewrite 将输出中仍指向wrapped.go、但实际来自用户代码的位置替换为原始文件的位置
+func (lm *lineMap) rewrite(output string) string {
+	if lm == nil {
+		return output
+	}
+	return wrapperPosRegex.ReplaceAllStringFunc(output, func(m string) string {
+		sub := wrapperPosRegex.FindStringSubmatch(m)
+		n, err := strconv.Atoi(sub[1])
+		if err != nil || n < 1 || n > len(lm.lines) {
+			return m
+		}
+		pos := lm.lines[n-1]
+		if pos.file == lm.wrapper {
+			return m
+		}
+		if sub[2] != "" {
+			return fmt.Sprintf("%s:%d:%s", pos.file, pos.line, sub[2])
+		}
+		return fmt.Sprintf("%s:%d", pos.file, pos.line)
+	})
+}
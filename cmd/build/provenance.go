@@ -0,0 +1,95 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"github.com/nostalgist134/FuzzGIUPluginKit/env"
+	"github.com/nostalgist134/FuzzGIUPluginKit/version"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// hashSources 计算参与编译的源文件的sha256，文件按路径排序，文件名也参与计算
+func hashSources(files []string) (string, error) {
+	files = slices.Clone(files)
+	slices.Sort(files)
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00", filepath.Base(f))
+		fd, err := os.Open(f)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, fd)
+		fd.Close()
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte{0})
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// gitRevision 获取源码目录所在git仓库的提交哈希，以及参与编译的文件是否有未提交的修改，不在git仓库中时返回空字符串
+func gitRevision(srcDir string, files []string) (rev string, dirty bool) {
+	c := exec.Command("git", "rev-parse", "HEAD")
+	c.Dir = srcDir
+	out, err := c.Output()
+	if err != nil {
+		return "", false
+	}
+	rev = strings.TrimSpace(string(out))
+	// 只关心参与编译的文件（编译产物等其它文件不算），未被跟踪的源文件也算作修改
+	c = exec.Command("git", append([]string{"status", "--porcelain", "--"}, files...)...)
+	c.Dir = srcDir
+	out, err = c.Output()
+	dirty = err == nil && len(strings.TrimSpace(string(out))) > 0
+	return
+}
+
+// listModules 获取插件构建时使用的模块列表（go list -m all）
+func listModules(goPath string, srcDir string, modFile string) ([]string, error) {
+	if modFile == "" {
+		return nil, nil
+	}
+	c := exec.Command(goPath, "list", "-m", "-modfile="+modFile, "all")
+	c.Dir = srcDir
+	out, err := c.Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSpace(string(out)), "\n"), nil
+}
+
+// collectProvenance 收集插件的构建来源信息，单项信息获取失败时只输出警告
+func collectProvenance(goPath string, srcDir string, modFile string, files []string) *convention.BuildProvenance {
+	bp := &convention.BuildProvenance{
+		FgpkVersion: version.GetVersion(),
+		Time:        time.Now().UTC().Format(time.RFC3339),
+		HostOS:      runtime.GOOS,
+		HostArch:    runtime.GOARCH,
+	}
+	var err error
+	if bp.SourceHash, err = hashSources(files); err != nil {
+		fmt.Printf("warning: hash source files failed - %v\n", err)
+	}
+	vcsFiles := files
+	if modRoot := env.FindModRoot(srcDir); modRoot != "" {
+		vcsFiles = append(slices.Clone(files), filepath.Join(modRoot, "go.mod"), filepath.Join(modRoot, "go.sum"))
+	}
+	if bp.Revision, bp.Dirty = gitRevision(srcDir, vcsFiles); bp.Revision != "" {
+		bp.VCS = "git"
+	}
+	if bp.Modules, err = listModules(goPath, srcDir, modFile); err != nil {
+		fmt.Printf("warning: list modules failed - %v\n", err)
+	}
+	return bp
+}
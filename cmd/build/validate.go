@@ -0,0 +1,219 @@
+package build
+
+import (
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"github.com/nostalgist134/FuzzGIUPluginKit/goParser"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// checkedFunc 需要解析参数类型的函数
+type checkedFunc struct {
+	name string
+	fd   *convention.FuncDecl
+}
+
+// generatedSymbols 返回包装代码生成的包级别符号及其说明，插件包中不能声明同名的符号
+func generatedSymbols(pType string, genInfo bool, minorFuncExist bool, helperSyms []string,
+	defaultHooks []string) map[string]string {
+	syms := map[string]string{
+		"PluginWrapper": "the generated wrapper function",
+		"main":          "the generated main function",
+	}
+	if genInfo {
+		syms["PluginInfo"] = "the PluginInfo function generated by -i"
+		syms["pluginInfoRaw"] = "the PluginInfo data generated by -i"
+	}
+	for _, h := range helperSyms {
+		syms[h] = "a helper of the generated wrapper"
+	}
+	if pType == convention.PluginTypes[convention.IndPTypeIterator] && !minorFuncExist {
+		syms[convention.PluginMinorFun[convention.IndPTypeIteratorMinor]] = "the generated default IterLen function"
+	}
+	for _, hook := range defaultHooks {
+		syms[hook] = fmt.Sprintf("the generated default %s function", hook)
+	}
+	return syms
+}
+
+// resolvedTypeString 返回参数类型解析后的字符串，可变参数写作...T
+func resolvedTypeString(sig *types.Signature, i int) string {
+	t := types.Unalias(sig.Params().At(i).Type())
+	if sig.Variadic() && i == sig.Params().Len()-1 {
+		if s, ok := t.(*types.Slice); ok {
+			return "..." + types.TypeString(s.Elem(), goParser.Qualifier)
+		}
+	}
+	return types.TypeString(t, goParser.Qualifier)
+}
+
+// checkFuncTypes 检查函数的参数与返回值类型解析后是否与源码中的写法一致，
+// 不一致说明类型名被包内的声明遮蔽（如本地声明的string类型）或指向了其它同名的包
+func checkFuncTypes(pkg *goParser.TypedPackage, cf checkedFunc) []convention.Diagnostic {
+	diags := make([]convention.Diagnostic, 0)
+	fn, ok := pkg.Pkg.Scope().Lookup(cf.name).(*types.Func)
+	if !ok {
+		return diags
+	}
+	sig := fn.Type().(*types.Signature)
+	for i, p := range cf.fd.Params {
+		if i >= sig.Params().Len() {
+			break
+		}
+		resolved := resolvedTypeString(sig, i)
+		if strings.Contains(resolved, "invalid type") || resolved == p.Type {
+			continue
+		}
+		diags = append(diags, convention.Diagnostic{Pos: posOf(cf.fd.TypePos, i, cf.fd.Pos),
+			Msg: fmt.Sprintf("%s: param %d (%s) is written as %s, but the type resolves to %s", cf.name, i, p.Name,
+				p.Type, resolved)})
+	}
+	results := make([]string, 0, sig.Results().Len())
+	for i := 0; i < sig.Results().Len(); i++ {
+		results = append(results, types.TypeString(types.Unalias(sig.Results().At(i).Type()), goParser.Qualifier))
+	}
+	resolved := strings.Join(results, ", ")
+	if !strings.Contains(resolved, "invalid type") && resolved != cf.fd.RetType {
+		diags = append(diags, convention.Diagnostic{Pos: cf.fd.RetPos,
+			Msg: fmt.Sprintf("%s: return type is written as %s, but resolves to %s", cf.name, cf.fd.RetType,
+				resolved)})
+	}
+	return diags
+}
+
+func posOf(positions []token.Position, i int, fallback token.Position) token.Position {
+	if i < len(positions) {
+		return positions[i]
+	}
+	return fallback
+}
+
+// checkClashes 检查包中与生成的符号或包装代码的import冲突的声明
+func checkClashes(pkg *goParser.TypedPackage, pluginFile string, generated map[string]string,
+	wrapperImports map[string]string) []convention.Diagnostic {
+	diags := make([]convention.Diagnostic, 0)
+	scope := pkg.Pkg.Scope()
+	for name, what := range generated {
+		obj := scope.Lookup(name)
+		if obj == nil {
+			continue
+		}
+		diags = append(diags, convention.Diagnostic{Pos: pkg.Fset.Position(obj.Pos()),
+			Msg: fmt.Sprintf("%s %s clashes with %s, rename it", objKind(obj), name, what)})
+	}
+
+	// 包装代码的import声明在wrapped.go的文件作用域中，包级别的同名声明会与之冲突
+	for name, path := range wrapperImports {
+		if obj := scope.Lookup(name); obj != nil {
+			diags = append(diags, convention.Diagnostic{Pos: pkg.Fset.Position(obj.Pos()),
+				Msg: fmt.Sprintf("%s %s clashes with import %q of the generated wrapper, rename it", objKind(obj),
+					name, path)})
+		}
+	}
+	// 插件函数所在文件的import会被合并到wrapped.go中，同名但路径不同的import无法共存
+	for _, file := range pkg.Files {
+		if pkg.Fset.Position(file.Package).Filename != pluginFile {
+			continue
+		}
+		for _, spec := range file.Imports {
+			name, path := importedName(pkg, spec)
+			if want, ok := wrapperImports[name]; ok && want != path {
+				diags = append(diags, convention.Diagnostic{Pos: pkg.Fset.Position(spec.Pos()),
+					Msg: fmt.Sprintf("import %q is named %s, which clashes with import %q of the generated "+
+						"wrapper, import it under another name", path, name, want)})
+			}
+		}
+	}
+	return diags
+}
+
+// importedName 返回import语句在文件作用域中声明的名字与导入路径
+func importedName(pkg *goParser.TypedPackage, spec *ast.ImportSpec) (string, string) {
+	var obj types.Object
+	if spec.Name != nil {
+		obj = pkg.Info.Defs[spec.Name]
+	} else {
+		obj = pkg.Info.Implicits[spec]
+	}
+	if pn, ok := obj.(*types.PkgName); ok {
+		return pn.Name(), pn.Imported().Path()
+	}
+	path := strings.Trim(spec.Path.Value, "\"`")
+	if spec.Name != nil {
+		return spec.Name.Name, path
+	}
+	return path[strings.LastIndex(path, "/")+1:], path
+}
+
+func objKind(obj types.Object) string {
+	switch obj.(type) {
+	case *types.Func:
+		return "function"
+	case *types.TypeName:
+		return "type"
+	case *types.Const:
+		return "constant"
+	}
+	return "variable"
+}
+
+// typeErrorDiags 将类型检查的错误转换为带位置的问题
+func typeErrorDiags(pkg *goParser.TypedPackage) []convention.Diagnostic {
+	diags := make([]convention.Diagnostic, 0)
+	for _, e := range pkg.Errors {
+		// 以制表符开头的是上一条错误的补充说明（如重复声明的另一处位置）
+		if strings.HasPrefix(e.Msg, "\t") && len(diags) > 0 {
+			diags[len(diags)-1].Msg += fmt.Sprintf("\n\t%s: %s", e.Fset.Position(e.Pos), strings.TrimSpace(e.Msg))
+			continue
+		}
+		diags = append(diags, convention.Diagnostic{Pos: e.Fset.Position(e.Pos), Msg: e.Msg})
+	}
+	return diags
+}
+
+func sortDiags(diags []convention.Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i].Pos, diags[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+}
+
+// validatePackage 编译前使用go/types对插件包进行类型检查，返回所有问题。依赖包无法导入时只给出警告，
+// 依赖于这些包的类型不再检查
+func validatePackage(srcDir string, files []string, modFile string, pluginFile string, funcs []checkedFunc,
+	generated map[string]string, wrapperImports map[string]string) ([]convention.Diagnostic, error) {
+	pkg, err := goParser.TypeCheck(srcDir, files, modFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range pkg.ImportErr {
+		fmt.Printf("warning: %s: %s, types from it are not checked\n", e.Fset.Position(e.Pos), e.Msg)
+	}
+
+	diags := typeErrorDiags(pkg)
+	diags = append(diags, checkClashes(pkg, pluginFile, generated, wrapperImports)...)
+	for _, cf := range funcs {
+		diags = append(diags, checkFuncTypes(pkg, cf)...)
+	}
+	sortDiags(diags)
+	return diags, nil
+}
+
+// validateWrapper 对渲染后的包装代码（与包内其它文件一起）进行类型检查，捕获模板中未声明的变量、未使用的import等问题。
+// 依赖包无法导入的警告在检查插件包时已经给出，这里不再重复
+func validateWrapper(srcDir string, files []string, modFile string) ([]convention.Diagnostic, error) {
+	pkg, err := goParser.TypeCheck(srcDir, files, modFile)
+	if err != nil {
+		return nil, err
+	}
+	diags := typeErrorDiags(pkg)
+	sortDiags(diags)
+	return diags, nil
+}
@@ -3,8 +3,12 @@ package cmd
 import (
 	"fmt"
 	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/build"
+	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/common"
+	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/compat"
+	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/fix"
 	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/gen"
 	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/info"
+	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/selftest"
 	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/test"
 	"github.com/nostalgist134/FuzzGIUPluginKit/version"
 	"github.com/spf13/cobra"
@@ -13,9 +17,18 @@ import (
 var entry = &cobra.Command{}
 
 func init() {
+	entry.PersistentFlags().Bool("non-interactive", false, "never prompt for user input "+
+		"(automatically enabled when stdin is not a terminal)")
+	entry.PersistentPreRun = func(cmd *cobra.Command, _ []string) {
+		nonInteractive, _ := cmd.Flags().GetBool("non-interactive")
+		common.SetNonInteractive(nonInteractive)
+	}
 	entry.AddCommand(build.Cmd)
+	entry.AddCommand(compat.Cmd)
+	entry.AddCommand(fix.Cmd)
 	entry.AddCommand(gen.Cmd)
 	entry.AddCommand(info.Cmd)
+	entry.AddCommand(selftest.Cmd)
 	entry.AddCommand(test.Cmd)
 	oldHelp := entry.HelpFunc()
 	entry.SetHelpFunc(func(cmd *cobra.Command, args []string) {
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// go插件只有在与宿主程序的构建环境一致时才能被加载，这些构建设置不同会导致加载失败
+var compatSettings = []string{
+	"-tags", "GOEXPERIMENT", "CGO_ENABLED", "GOOS", "GOARCH", "GOAMD64", "GOARM", "GOARM64", "GO386",
+	"GOMIPS", "GOMIPS64", "GOPPC64", "GORISCV64", "GOWASM", "-race", "-msan", "-asan", "-trimpath",
+}
+
+// BuildInfoMismatch 宿主程序与插件构建信息中的一处不一致
+type BuildInfoMismatch struct {
+	Kind   string // go version、module或setting
+	Name   string // 模块路径或构建设置名
+	Host   string
+	Plugin string
+	Fix    string // 修复建议
+}
+
+func (m BuildInfoMismatch) String() string {
+	show := func(s string) string {
+		if s == "" {
+			return "<none>"
+		}
+		return s
+	}
+	name := m.Kind
+	if m.Name != "" {
+		name += " " + m.Name
+	}
+	return fmt.Sprintf("%s: host %s, plugin %s", name, show(m.Host), show(m.Plugin))
+}
+
+// ReadBuildInfo 读取二进制文件中嵌入的构建信息，不会加载或执行该文件
+func ReadBuildInfo(binFile string) (*debug.BuildInfo, error) {
+	return buildinfo.ReadFile(binFile)
+}
+
+// ReadSelfBuildInfo 读取fgpk自身的构建信息
+func ReadSelfBuildInfo() (*debug.BuildInfo, error) {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil, fmt.Errorf("build info of fgpk itself is not available")
+	}
+	return bi, nil
+}
+
+// modVersion 返回模块实际使用的版本（被replace时为replace的目标）
+func modVersion(m *debug.Module) string {
+	if m.Replace != nil {
+		if m.Replace.Version == "" {
+			return m.Replace.Path
+		}
+		return m.Replace.Path + "@" + m.Replace.Version
+	}
+	return m.Version
+}
+
+func modSum(m *debug.Module) string {
+	if m.Replace != nil {
+		return m.Replace.Sum
+	}
+	return m.Sum
+}
+
+// modFix 根据宿主程序使用的模块版本生成插件go.mod中应做的修改
+func modFix(hostMod *debug.Module) string {
+	if hostMod.Replace != nil {
+		if hostMod.Replace.Version == "" {
+			return fmt.Sprintf("replace %s => %s", hostMod.Path, hostMod.Replace.Path)
+		}
+		return fmt.Sprintf("replace %s => %s %s", hostMod.Path, hostMod.Replace.Path, hostMod.Replace.Version)
+	}
+	return fmt.Sprintf("require %s %s", hostMod.Path, hostMod.Version)
+}
+
+func buildSettings(bi *debug.BuildInfo) map[string]string {
+	settings := make(map[string]string)
+	for _, s := range bi.Settings {
+		settings[s.Key] = s.Value
+	}
+	return settings
+}
+
+// IsCShared 插件是否以-buildmode=c-shared编译（build --abi cgo），这样的插件只能通过dlopen或LoadDLL加载，
+// 交给plugin.Open会使进程以无法恢复的"no plugin module data"错误退出。读取不到构建信息时返回false
+func IsCShared(binFile string) bool {
+	bi, err := ReadBuildInfo(binFile)
+	if err != nil {
+		return false
+	}
+	return buildSettings(bi)["-buildmode"] == "c-shared"
+}
+
+// CompareBuildInfo 比较宿主程序与插件的构建信息，返回所有会导致插件无法加载的不一致项
+func CompareBuildInfo(host, plugin *debug.BuildInfo) []BuildInfoMismatch {
+	mismatches := make([]BuildInfoMismatch, 0)
+
+	if host.GoVersion != plugin.GoVersion {
+		mismatches = append(mismatches, BuildInfoMismatch{
+			Kind:   "go version",
+			Host:   host.GoVersion,
+			Plugin: plugin.GoVersion,
+			Fix: fmt.Sprintf("build the plugin with %s (e.g. add \"toolchain %s\" to the plugin's go.mod "+
+				"or use build -g)", host.GoVersion, host.GoVersion),
+		})
+	}
+
+	// 宿主程序的主模块也可能是插件的依赖（例如插件依赖了FuzzGIU）
+	hostMods := make(map[string]*debug.Module)
+	for _, m := range host.Deps {
+		hostMods[m.Path] = m
+	}
+	if host.Main.Path != "" && host.Main.Version != "" && host.Main.Version != "(devel)" {
+		hostMods[host.Main.Path] = &host.Main
+	}
+
+	for _, pm := range plugin.Deps {
+		hm, ok := hostMods[pm.Path]
+		if !ok {
+			continue
+		}
+		hVer, pVer := modVersion(hm), modVersion(pm)
+		hSum, pSum := modSum(hm), modSum(pm)
+		if hVer == pVer && (hSum == "" || pSum == "" || hSum == pSum) {
+			continue
+		}
+		if hVer == pVer {
+			hVer += " (" + hSum + ")"
+			pVer += " (" + pSum + ")"
+		}
+		mismatches = append(mismatches, BuildInfoMismatch{
+			Kind:   "module",
+			Name:   pm.Path,
+			Host:   hVer,
+			Plugin: pVer,
+			Fix:    "in the plugin's go.mod: " + modFix(hm),
+		})
+	}
+
+	hostSettings, pluginSettings := buildSettings(host), buildSettings(plugin)
+	for _, key := range compatSettings {
+		hv, pv := hostSettings[key], pluginSettings[key]
+		if hv == pv {
+			continue
+		}
+		fix := ""
+		switch {
+		case hv == "" && strings.HasPrefix(key, "-"):
+			fix = fmt.Sprintf("build the plugin without %s", key)
+		case hv == "":
+			fix = fmt.Sprintf("build the plugin with %s unset", key)
+		case key == "-tags":
+			fix = fmt.Sprintf("build the plugin with -tags=%q", hv)
+		case strings.HasPrefix(key, "-"):
+			fix = fmt.Sprintf("build the plugin with %s=%s", key, hv)
+		default:
+			fix = fmt.Sprintf("build the plugin with %s=%s in the environment", key, hv)
+		}
+		mismatches = append(mismatches, BuildInfoMismatch{
+			Kind:   "setting",
+			Name:   key,
+			Host:   hv,
+			Plugin: pv,
+			Fix:    fix,
+		})
+	}
+
+	return mismatches
+}
@@ -0,0 +1,192 @@
+package common
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"reflect"
+	"runtime"
+	"unsafe"
+)
+
+// cgoProc c-shared动态库中导出的函数，参数与返回值均为机器字
+type cgoProc func(args ...uintptr) uintptr
+
+// CgoErr cgo方式下导出函数返回的错误信号
+const CgoErr = ^uintptr(0)
+
+// CgoFirstBufLen 第一次调用时提供的缓冲区大小，与windows上GetPluginInfo的第一次尝试相同
+const CgoFirstBufLen = 640
+
+// cgoArgs 转换为机器字的参数，keep中保存参数指向的内存，调用结束之前不能被回收
+type cgoArgs struct {
+	words []uintptr
+	keep  [][]byte
+}
+
+func (ca *cgoArgs) bytes(b []byte) {
+	if len(b) == 0 {
+		ca.words = append(ca.words, 0, 0)
+		return
+	}
+	ca.keep = append(ca.keep, b)
+	ca.words = append(ca.words, uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)))
+}
+
+// cgoArgWords 按cgo模板中导出函数的参数列表，将插件函数的实参转换为机器字（不含开头的dst与dstLen）：
+// string以及序列化为json的结构体为指针与长度两个字，iterator的lengths编码为int32个数加上各个下标，
+// 之后是其长度与选择调用IterIndex的参数，整数与bool各占一个字
+func cgoArgWords(pType string, args []any) (*cgoArgs, error) {
+	ca := &cgoArgs{}
+	for i, a := range args {
+		if a == nil {
+			return nil, fmt.Errorf("argument #%d is nil", i)
+		}
+		if ints, ok := a.([]int); ok && i == 0 && pType == convention.PluginTypes[convention.IndPTypeIterator] {
+			b := make([]byte, 4+8*len(ints))
+			binary.LittleEndian.PutUint32(b, uint32(len(ints)))
+			for j, n := range ints {
+				binary.LittleEndian.PutUint64(b[4+8*j:], uint64(n))
+			}
+			ca.keep = append(ca.keep, b)
+			ca.words = append(ca.words, uintptr(unsafe.Pointer(&b[0])), uintptr(len(ints)), 0)
+			continue
+		}
+		rv := reflect.ValueOf(a)
+		switch rv.Kind() {
+		case reflect.String:
+			ca.bytes([]byte(rv.String()))
+		case reflect.Pointer:
+			j, err := json.Marshal(a)
+			if err != nil {
+				return nil, err
+			}
+			ca.bytes(j)
+		case reflect.Slice:
+			// 已经编码好的json（如json.RawMessage）原样传递，用于构造格式错误的输入
+			if rv.Type().Elem().Kind() != reflect.Uint8 {
+				return nil, fmt.Errorf("argument #%d of type %T can't be passed through the cgo ABI", i, a)
+			}
+			ca.bytes(rv.Bytes())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			ca.words = append(ca.words, uintptr(rv.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			ca.words = append(ca.words, uintptr(rv.Uint()))
+		case reflect.Bool:
+			w := uintptr(0)
+			if rv.Bool() {
+				w = 1
+			}
+			ca.words = append(ca.words, w)
+		default:
+			return nil, fmt.Errorf("argument #%d of type %T can't be passed through the cgo ABI", i, a)
+		}
+	}
+	return ca, nil
+}
+
+// callCgoBuffered 按cgo方式的缓冲区协商约定调用导出函数：先提供CgoFirstBufLen字节的缓冲区，
+// 返回值大于缓冲区长度时表示所需长度，按所需长度重新调用；返回CgoErr表示出错
+func callCgoBuffered(name string, proc cgoProc, ca *cgoArgs) ([]byte, error) {
+	buf := make([]byte, CgoFirstBufLen)
+	for try := 0; try < 2; try++ {
+		words := append([]uintptr{uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf))}, ca.words...)
+		ret := proc(words...)
+		runtime.KeepAlive(buf)
+		runtime.KeepAlive(ca)
+		if ret == CgoErr {
+			return nil, fmt.Errorf("%s returned the error signal ^uintptr(0)", name)
+		}
+		if int(ret) <= len(buf) {
+			return buf[:ret], nil
+		}
+		buf = make([]byte, ret)
+	}
+	return nil, fmt.Errorf("%s kept asking for a larger buffer (%d bytes)", name, len(buf))
+}
+
+// CgoFunc c-shared方式编译的插件中的导出函数及其参数，可以使用任意的缓冲区调用，用于检查缓冲区协商约定
+type CgoFunc struct {
+	Name string
+	proc cgoProc
+	ca   *cgoArgs
+}
+
+// OpenCgoFunc 加载c-shared方式编译的插件并查找导出函数name，args为插件函数的完整实参列表（PluginInfo为空）
+func OpenCgoFunc(libFile string, name string, pType string, args []any) (*CgoFunc, error) {
+	proc, err := openCgoProc(libFile, name)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := cgoArgWords(pType, args)
+	if err != nil {
+		return nil, err
+	}
+	return &CgoFunc{Name: name, proc: proc, ca: ca}, nil
+}
+
+// Call 以dst为缓冲区调用导出函数，dst为nil时传入空指针。dstLen可以小于len(dst)，以便在缓冲区末尾留出检查越界写入的区域
+func (f *CgoFunc) Call(dst []byte, dstLen int) uintptr {
+	ptr := uintptr(0)
+	if len(dst) > 0 {
+		ptr = uintptr(unsafe.Pointer(&dst[0]))
+	}
+	ret := f.proc(append([]uintptr{ptr, uintptr(dstLen)}, f.ca.words...)...)
+	runtime.KeepAlive(dst)
+	runtime.KeepAlive(f.ca)
+	return ret
+}
+
+// CallCgoWrapper 加载c-shared方式编译的插件并调用其PluginWrapper，args为插件函数的完整实参列表
+func CallCgoWrapper(libFile string, pType string, args []any) ([]byte, error) {
+	proc, err := openCgoProc(libFile, "PluginWrapper")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := cgoArgWords(pType, args)
+	if err != nil {
+		return nil, err
+	}
+	return callCgoBuffered("PluginWrapper", proc, ca)
+}
+
+// GetCgoPluginInfo 通过dlopen调用c-shared方式编译的插件的PluginInfo函数，用于在非windows系统上测试cgo方式的插件
+func GetCgoPluginInfo(libFile string) (*convention.PluginInfo, error) {
+	proc, err := openCgoProc(libFile, "PluginInfo")
+	if err != nil {
+		return nil, err
+	}
+	b, err := callCgoBuffered("PluginInfo", proc, &cgoArgs{})
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("PluginInfo returned empty")
+	}
+	pi := new(convention.PluginInfo)
+	err = json.Unmarshal(b, pi)
+	return pi, err
+}
+
+// CgoClosePlugin 调用c-shared方式编译的插件导出的PluginClose，即插件的Close函数，并清空Init的缓存
+func CgoClosePlugin(libFile string) error {
+	proc, err := openCgoProc(libFile, "PluginClose")
+	if err != nil {
+		return err
+	}
+	if proc() == CgoErr {
+		return errors.New("PluginClose returned the error signal ^uintptr(0)")
+	}
+	return nil
+}
+
+// CgoInitCalls 返回c-shared方式编译的插件的Init实际被调用的次数
+func CgoInitCalls(libFile string) (int, error) {
+	proc, err := openCgoProc(libFile, "PluginInitCalls")
+	if err != nil {
+		return 0, err
+	}
+	return int(proc()), nil
+}
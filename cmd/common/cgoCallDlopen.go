@@ -0,0 +1,72 @@
+//go:build (linux || darwin) && cgo
+
+package common
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+// 导出函数的参数都是整数类别，多传入的参数会被忽略，因此统一以最大个数调用
+typedef uintptr_t (*fgpk_proc)(uintptr_t, uintptr_t, uintptr_t, uintptr_t, uintptr_t, uintptr_t,
+	uintptr_t, uintptr_t, uintptr_t, uintptr_t, uintptr_t, uintptr_t);
+
+static uintptr_t fgpk_call(void *f, uintptr_t *a) {
+	return ((fgpk_proc)f)(a[0], a[1], a[2], a[3], a[4], a[5], a[6], a[7], a[8], a[9], a[10], a[11]);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"unsafe"
+)
+
+// cgoMaxWords fgpk_call最多传递的机器字个数
+const cgoMaxWords = 12
+
+var (
+	// cgoLibs 已经加载的动态库，go编写的c-shared库无法卸载，同一个库只加载一次
+	cgoLibs  = make(map[string]unsafe.Pointer)
+	cgoLibMu sync.Mutex
+)
+
+// openCgoProc 通过dlopen加载c-shared方式编译的插件，并查找其中的导出函数
+func openCgoProc(libFile string, name string) (cgoProc, error) {
+	abs, err := filepath.Abs(libFile)
+	if err != nil {
+		return nil, err
+	}
+	cgoLibMu.Lock()
+	defer cgoLibMu.Unlock()
+	handle, ok := cgoLibs[abs]
+	if !ok {
+		cPath := C.CString(abs)
+		defer C.free(unsafe.Pointer(cPath))
+		handle = C.dlopen(cPath, C.RTLD_NOW|C.RTLD_LOCAL)
+		if handle == nil {
+			return nil, &PluginOpenError{Err: fmt.Errorf("dlopen %s: %s", abs, C.GoString(C.dlerror()))}
+		}
+		cgoLibs[abs] = handle
+	}
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	sym := C.dlsym(handle, cName)
+	if sym == nil {
+		return nil, fmt.Errorf("%s not found in %s", name, abs)
+	}
+	return func(args ...uintptr) uintptr {
+		if len(args) > cgoMaxWords {
+			panic(errors.New("too many arguments for a cgo call"))
+		}
+		var words [cgoMaxWords]C.uintptr_t
+		for i, a := range args {
+			words[i] = C.uintptr_t(a)
+		}
+		return uintptr(C.fgpk_call(sym, &words[0]))
+	}, nil
+}
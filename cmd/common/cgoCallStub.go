@@ -0,0 +1,10 @@
+//go:build !windows && !((linux || darwin) && cgo)
+
+package common
+
+import "errors"
+
+// openCgoProc 未启用cgo时无法通过dlopen加载c-shared方式编译的插件
+func openCgoProc(string, string) (cgoProc, error) {
+	return nil, errors.ErrUnsupported
+}
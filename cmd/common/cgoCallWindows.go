@@ -0,0 +1,40 @@
+//go:build windows
+
+package common
+
+import (
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+var (
+	// cgoLibs 已经加载的动态库，同一个库只加载一次
+	cgoLibs  = make(map[string]*syscall.DLL)
+	cgoLibMu sync.Mutex
+)
+
+// openCgoProc 加载插件的动态链接库，并查找其中的导出函数
+func openCgoProc(libFile string, name string) (cgoProc, error) {
+	abs, err := filepath.Abs(libFile)
+	if err != nil {
+		return nil, err
+	}
+	cgoLibMu.Lock()
+	defer cgoLibMu.Unlock()
+	dll, ok := cgoLibs[abs]
+	if !ok {
+		if dll, err = syscall.LoadDLL(abs); err != nil {
+			return nil, &PluginOpenError{Err: err}
+		}
+		cgoLibs[abs] = dll
+	}
+	proc, err := dll.FindProc(name)
+	if err != nil {
+		return nil, err
+	}
+	return func(args ...uintptr) uintptr {
+		ret, _, _ := proc.Call(args...)
+		return ret
+	}, nil
+}
@@ -3,12 +3,16 @@ package common
 import (
 	"bufio"
 	"fmt"
+	"golang.org/x/term"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 )
 
 var subCmd = ""
 var exitDefer = func() {}
+var nonInteractive = false
 
 func SetCurrentCmd(sub string) {
 	subCmd = sub
@@ -22,6 +26,26 @@ func ClearExitDefer() {
 	exitDefer = func() {}
 }
 
+// SetNonInteractive 禁止所有需要从标准输入读取用户决定的提示
+func SetNonInteractive(b bool) {
+	nonInteractive = b
+}
+
+// IsInteractive 判断当前能否向用户提问：未指定--non-interactive，且标准输入是终端（CI中通常是管道或/dev/null）
+func IsInteractive() bool {
+	return !nonInteractive && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// ExitOnInterrupt 收到中断信号（如Ctrl-C）时同样通过FailExit退出，从而执行退出前的清理函数
+func ExitOnInterrupt() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		FailExit(fmt.Sprintf("received signal %v", sig))
+	}()
+}
+
 // FailExit 接收错误信息或错误类型，如果接收错误信息则退出，如果接收到nil则直接返回，不退出（这么改之后就能少写几个panic了）
 func FailExit(reason any, code ...int) {
 	if reason == nil {
@@ -36,8 +60,11 @@ func FailExit(reason any, code ...int) {
 	os.Exit(exitCode)
 }
 
-// ReadInputLine 从用户输入中读取一行
+// ReadInputLine 从用户输入中读取一行，非交互模式下直接失败退出
 func ReadInputLine(prompt string, trim ...bool) string {
+	if !IsInteractive() {
+		FailExit(fmt.Sprintf("%s: cannot read user input in non-interactive mode", strings.TrimSpace(prompt)))
+	}
 	fmt.Print(prompt)
 	reader := bufio.NewReader(os.Stdin)
 	line, err := reader.ReadString('\n')
@@ -49,3 +76,23 @@ func ReadInputLine(prompt string, trim ...bool) string {
 	}
 	return line
 }
+
+// GetUserYN 获取用户输入Yes/No选项，非交互模式下不读取输入，直接返回false
+func GetUserYN(prompt string) bool {
+	if !IsInteractive() {
+		fmt.Printf("%s (Y/N): N (non-interactive)\n", prompt)
+		return false
+	}
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("%s (Y/N): ", prompt)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to get user decision:", err)
+		return false
+	}
+	line = strings.TrimSpace(line)
+	if strings.ToLower(line) == "y" {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package common
+
+import (
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"github.com/nostalgist134/FuzzGIUPluginKit/goParser"
+	"github.com/nostalgist134/FuzzGIUPluginKit/version"
+	"slices"
+)
+
+const (
+	DirectiveVersion  = "version"  // //fgpk:version 1.4.0，插件自身的版本
+	DirectiveRequires = "requires" // //fgpk:requires fuzzgiu>=0.2.8，插件要求的FuzzGIU版本
+)
+
+var knownDirectives = []string{DirectiveVersion, DirectiveRequires, DirectiveType}
+
+// requireTargets 可以在//fgpk:requires中声明版本要求的组件
+var requireTargets = []string{"fuzzgiu"}
+
+// ApplyDirectives 读取源文件中的fgpk指令，检查后写入插件元信息
+func ApplyDirectives(pi *convention.PluginInfo, files []string) error {
+	directives, err := goParser.FindDirectives(files)
+	if err != nil {
+		return err
+	}
+	for _, d := range directives {
+		if !slices.Contains(knownDirectives, d.Name) {
+			return fmt.Errorf("%s: unknown directive %s%s", d.Pos, goParser.DirectivePrefix, d.Name)
+		}
+	}
+
+	versions := goParser.Directives(directives, DirectiveVersion)
+	if len(versions) > 1 {
+		return fmt.Errorf("%s: duplicate %s%s directive, first declared at %s", versions[1].Pos,
+			goParser.DirectivePrefix, DirectiveVersion, versions[0].Pos)
+	} else if len(versions) == 1 {
+		if _, err = version.ParseSemver(versions[0].Value); err != nil {
+			return fmt.Errorf("%s: %w", versions[0].Pos, err)
+		}
+		pi.Version = versions[0].Value
+	}
+
+	for _, d := range goParser.Directives(directives, DirectiveRequires) {
+		r, err := version.ParseRequirement(d.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.Pos, err)
+		}
+		if !slices.Contains(requireTargets, r.Name) {
+			return fmt.Errorf("%s: unknown requirement target %q, supported: %v", d.Pos, r.Name, requireTargets)
+		}
+		pi.Requires = append(pi.Requires, r.String())
+	}
+	return nil
+}
+
+// CheckRequires 检查插件声明的FuzzGIU版本要求是否包含fgpk所遵循的约定版本
+func CheckRequires(pi *convention.PluginInfo) error {
+	target, _ := version.ParseSemver(version.FuzzGIUConvention)
+	for _, req := range pi.Requires {
+		r, err := version.ParseRequirement(req)
+		if err != nil {
+			return err
+		}
+		if r.Name == "fuzzgiu" && !r.Allows(target) {
+			return fmt.Errorf("plugin requires %s, but fgpk targets FuzzGIU %s conventions", r,
+				version.FuzzGIUConvention)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"github.com/nostalgist134/FuzzGIUPluginKit/goParser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const DirectiveType = "type" // //fgpk:type reactor，指定插件类型
+
+// PluginEntry 插件的入口函数（约定的插件函数）
+type PluginEntry struct {
+	Type     string
+	FunName  string
+	Fd       *convention.FuncDecl
+	ParaMeta []convention.ParaMeta
+	File     string // 函数所在的文件
+}
+
+// FindPluginEntries 在源文件中查找所有约定的插件函数
+func FindPluginEntries(files []string) ([]PluginEntry, error) {
+	entries := make([]PluginEntry, 0)
+	for i, fn := range convention.PluginFunNames {
+		fd, paraMeta, file, err := goParser.FindFunctionInFiles(files, fn)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, PluginEntry{
+			Type:     convention.PluginTypes[i],
+			FunName:  fn,
+			Fd:       fd,
+			ParaMeta: paraMeta,
+			File:     file,
+		})
+	}
+	return entries, nil
+}
+
+// ResolvePluginEntry 确定插件的入口函数：有//fgpk:type指令时使用指令指定的类型，否则要求源码中只有一个约定的插件函数
+func ResolvePluginEntry(files []string) (*PluginEntry, error) {
+	entries, err := FindPluginEntries(files)
+	if err != nil {
+		return nil, err
+	}
+	directives, err := goParser.FindDirectives(files)
+	if err != nil {
+		return nil, err
+	}
+	types := goParser.Directives(directives, DirectiveType)
+	if len(types) > 1 {
+		return nil, fmt.Errorf("%s: duplicate %s%s directive, first declared at %s", types[1].Pos,
+			goParser.DirectivePrefix, DirectiveType, types[0].Pos)
+	}
+
+	if len(types) == 1 {
+		d := types[0]
+		pType := ""
+		for _, t := range convention.PluginTypes {
+			if strings.EqualFold(t, d.Value) {
+				pType = t
+			}
+		}
+		if pType == "" {
+			return nil, fmt.Errorf("%s: unknown plugin type %q, supported: %v", d.Pos, d.Value,
+				convention.PluginTypes)
+		}
+		for i := range entries {
+			if entries[i].Type == pType {
+				return &entries[i], nil
+			}
+		}
+		return nil, fmt.Errorf("%s: plugin type is declared as %s, but function %s is not found", d.Pos, pType,
+			convention.GetPluginFunName(pType))
+	}
+
+	switch len(entries) {
+	case 0:
+		return nil, errors.New("cannot find supported plugin function")
+	case 1:
+		return &entries[0], nil
+	}
+	sb := strings.Builder{}
+	for _, e := range entries {
+		sb.WriteString(fmt.Sprintf("\n  %s (%s) in %s", e.FunName, e.Type, filepath.Base(e.File)))
+	}
+	return nil, fmt.Errorf("multiple plugin functions found, add a %s%s directive (e.g. %s%s %s) to "+
+		"specify the plugin type:%s", goParser.DirectivePrefix, DirectiveType, goParser.DirectivePrefix,
+		DirectiveType, entries[0].Type, sb.String())
+}
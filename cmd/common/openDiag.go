@@ -0,0 +1,118 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+var diffPkgRegex = regexp.MustCompile(`different version of package (\S+)`)
+
+// fuzzGIUModule fgpk自身依赖的FuzzGIU模块，插件与其版本不一致是最常见的加载失败原因
+const fuzzGIUModule = "github.com/nostalgist134/FuzzGIU"
+
+// PluginOpenError 加载插件失败时的错误，附带与当前程序构建信息的比较结果
+type PluginOpenError struct {
+	Err        error
+	Package    string // 错误信息中指出的冲突包
+	Module     string // 冲突包所属的模块
+	Diagnosis  string
+	Mismatches []BuildInfoMismatch
+}
+
+func (e *PluginOpenError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString(e.Err.Error())
+	if e.Diagnosis != "" {
+		sb.WriteString("\ndiagnosis: ")
+		sb.WriteString(e.Diagnosis)
+	}
+	// 无法从错误信息中定位到冲突包时，列出所有不一致项
+	if e.Package == "" && len(e.Mismatches) > 0 {
+		sb.WriteString("\nbuild info mismatches between this program and the plugin:")
+		for _, m := range e.Mismatches {
+			sb.WriteString("\n  [x] ")
+			sb.WriteString(m.String())
+			sb.WriteString("\n      fix: ")
+			sb.WriteString(m.Fix)
+		}
+	}
+	return sb.String()
+}
+
+func (e *PluginOpenError) Unwrap() error {
+	return e.Err
+}
+
+// CheckPluginBuildInfo 比较插件与当前程序的构建信息，返回会导致插件无法加载的不一致项
+func CheckPluginBuildInfo(pluginFile string) ([]BuildInfoMismatch, error) {
+	self, err := ReadSelfBuildInfo()
+	if err != nil {
+		return nil, err
+	}
+	pbi, err := ReadBuildInfo(pluginFile)
+	if err != nil {
+		return nil, err
+	}
+	return CompareBuildInfo(self, pbi), nil
+}
+
+// ownerModule 根据包路径找到其所属的模块（最长前缀匹配），标准库的包返回空字符串
+func ownerModule(pkg string, bi *debug.BuildInfo) string {
+	owner := ""
+	match := func(path string) {
+		if (pkg == path || strings.HasPrefix(pkg, path+"/")) && len(path) > len(owner) {
+			owner = path
+		}
+	}
+	match(bi.Main.Path)
+	for _, m := range bi.Deps {
+		match(m.Path)
+	}
+	return owner
+}
+
+// DiagnoseOpenError 分析plugin.Open返回的错误，指出冲突的包来自工具链、fgpk自身的FuzzGIU依赖还是插件的go.mod
+func DiagnoseOpenError(pluginFile string, openErr error) error {
+	pe := &PluginOpenError{Err: openErr}
+	pe.Mismatches, _ = CheckPluginBuildInfo(pluginFile)
+	self, err := ReadSelfBuildInfo()
+	if err != nil {
+		return pe
+	}
+
+	if sub := diffPkgRegex.FindStringSubmatch(openErr.Error()); sub != nil {
+		pe.Package = sub[1]
+		pe.Module = ownerModule(pe.Package, self)
+	}
+
+	var modMismatch *BuildInfoMismatch
+	for i, m := range pe.Mismatches {
+		if m.Kind == "module" && m.Name == pe.Module {
+			modMismatch = &pe.Mismatches[i]
+		}
+	}
+
+	switch {
+	case pe.Package == "":
+		if len(pe.Mismatches) > 0 {
+			pe.Diagnosis = "the plugin was not built in the same environment as this program, see mismatches below"
+		}
+	case pe.Module == "":
+		pe.Diagnosis = fmt.Sprintf("package %s belongs to the go standard library, the plugin must be built "+
+			"with the same go toolchain (%s) and build settings as this program", pe.Package, self.GoVersion)
+	case pe.Module == fuzzGIUModule && modMismatch != nil:
+		pe.Diagnosis = fmt.Sprintf("package %s belongs to %s, which fgpk itself depends on (%s) while the "+
+			"plugin uses %s. pin the plugin to fgpk's version - %s", pe.Package, pe.Module, modMismatch.Host,
+			modMismatch.Plugin, modMismatch.Fix)
+	case modMismatch != nil:
+		pe.Diagnosis = fmt.Sprintf("package %s belongs to module %s, the plugin's go.mod resolves it to %s "+
+			"while this program uses %s - %s", pe.Package, pe.Module, modMismatch.Plugin, modMismatch.Host,
+			modMismatch.Fix)
+	default:
+		pe.Diagnosis = fmt.Sprintf("package %s belongs to module %s, both sides use the same version, so the "+
+			"difference comes from the toolchain or build settings", pe.Package, pe.Module)
+	}
+	return pe
+}
@@ -10,6 +10,26 @@ import (
 	"unsafe"
 )
 
+// PreCheckPlugin windows上的插件为c-shared动态链接库，不要求与宿主程序的构建信息一致，无需检查
+func PreCheckPlugin(string) error {
+	return nil
+}
+
+// CallPluginWrapper c-shared动态链接库的PluginWrapper参数因插件而异，不支持直接调用
+func CallPluginWrapper(string, ...any) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// ClosePlugin windows上的插件为c-shared动态链接库，使用CgoClosePlugin
+func ClosePlugin(string) error {
+	return errors.ErrUnsupported
+}
+
+// PluginInitCalls windows上的插件为c-shared动态链接库，使用CgoInitCalls
+func PluginInitCalls(string) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
 // GetPluginInfo 调用插件的PluginInfo函数并返回
 func GetPluginInfo(pluginFile string) (*convention.PluginInfo, error) {
 	dll, err := syscall.LoadDLL(pluginFile)
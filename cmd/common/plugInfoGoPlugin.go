@@ -5,14 +5,49 @@ package common
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"os"
+	"path/filepath"
 	goPlugin "plugin"
 )
 
+// preChecked 已经检查过的插件，同一插件只输出一次警告
+var preChecked = make(map[string]bool)
+
+// PreCheckPlugin 在加载插件前比较插件与当前程序的构建信息，并输出会导致加载失败的不一致项。
+// c-shared方式编译的插件不能作为go插件加载，返回错误
+func PreCheckPlugin(pluginFile string) error {
+	if abs, err := filepath.Abs(pluginFile); err == nil {
+		pluginFile = abs
+	}
+	if IsCShared(pluginFile) {
+		return fmt.Errorf("%s is built with -buildmode=c-shared(build --abi cgo) and can't be loaded as a go "+
+			"plugin, use --abi cgo", pluginFile)
+	}
+	if preChecked[pluginFile] {
+		return nil
+	}
+	preChecked[pluginFile] = true
+	mismatches, err := CheckPluginBuildInfo(pluginFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cannot compare build info with plugin: %v\n", err)
+		return nil
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, "warning: the plugin is likely to fail loading, build info mismatches found:")
+	for _, m := range mismatches {
+		fmt.Fprintf(os.Stderr, "  [x] %s\n      fix: %s\n", m, m.Fix)
+	}
+	return nil
+}
+
 func GetPluginInfo(pluginFile string) (*convention.PluginInfo, error) {
 	p, err := goPlugin.Open(pluginFile)
 	if err != nil {
-		return nil, err
+		return nil, DiagnoseOpenError(pluginFile, err)
 	}
 
 	piSym, err := p.Lookup("PluginInfo")
@@ -38,3 +73,52 @@ func GetPluginInfo(pluginFile string) (*convention.PluginInfo, error) {
 
 	return ret, nil
 }
+
+// lookupPluginSym 加载go插件并查找导出的符号
+func lookupPluginSym(pluginFile string, name string) (goPlugin.Symbol, error) {
+	p, err := goPlugin.Open(pluginFile)
+	if err != nil {
+		return nil, DiagnoseOpenError(pluginFile, err)
+	}
+	return p.Lookup(name)
+}
+
+// CallPluginWrapper 直接调用插件的PluginWrapper函数。FuzzGIU调用插件失败时不会返回PluginWrapper的错误，
+// 测试时需要直接调用才能得到
+func CallPluginWrapper(pluginFile string, args ...any) ([]byte, error) {
+	sym, err := lookupPluginSym(pluginFile, "PluginWrapper")
+	if err != nil {
+		return nil, err
+	}
+	wrapper, ok := sym.(func(...any) ([]byte, error))
+	if !ok {
+		return nil, errors.New("PluginWrapper is not func(...any) ([]byte, error)")
+	}
+	return wrapper(args...)
+}
+
+// ClosePlugin 调用包装代码生成的PluginClose，即插件的Close函数，并清空Init的缓存
+func ClosePlugin(pluginFile string) error {
+	sym, err := lookupPluginSym(pluginFile, "PluginClose")
+	if err != nil {
+		return err
+	}
+	closeFun, ok := sym.(func() error)
+	if !ok {
+		return errors.New("PluginClose is not func() error")
+	}
+	return closeFun()
+}
+
+// PluginInitCalls 返回插件的Init实际被调用的次数
+func PluginInitCalls(pluginFile string) (int, error) {
+	sym, err := lookupPluginSym(pluginFile, "PluginInitCalls")
+	if err != nil {
+		return 0, err
+	}
+	callsFun, ok := sym.(func() int)
+	if !ok {
+		return 0, errors.New("PluginInitCalls is not func() int")
+	}
+	return callsFun(), nil
+}
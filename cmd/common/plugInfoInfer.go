@@ -0,0 +1,133 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"github.com/nostalgist134/FuzzGIUPluginKit/goParser"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// hasMainSymbol 判断二进制文件中是否存在main包的某个函数。go的函数名表（pclntab）在strip之后依然保留，
+// 其中的函数名以\x00结尾，main包的函数名前缀为其构建路径（插件为模块路径，c-shared库一般为main）
+func hasMainSymbol(b []byte, mainPaths []string, name string) bool {
+	for _, mp := range mainPaths {
+		if bytes.Contains(b, []byte("\x00"+mp+"."+name+"\x00")) {
+			return true
+		}
+	}
+	return false
+}
+
+// InferPluginInfo 为未使用-i编译的插件推测元信息：插件类型根据二进制文件中残留的函数名推测，go版本从构建信息中读取。
+// 若指定了source（源文件或目录），则插件类型与完整的参数列表从源码中获取
+func InferPluginInfo(pluginFile string, source string) (*convention.PluginInfo, error) {
+	pi := &convention.PluginInfo{Name: filepath.Base(pluginFile)}
+	bi, err := ReadBuildInfo(pluginFile)
+	mainPaths := []string{"main", "command-line-arguments"}
+	if err == nil {
+		pi.GoVersion = strings.TrimPrefix(bi.GoVersion, "go")
+		if bi.Path != "" {
+			mainPaths = append([]string{bi.Path}, mainPaths...)
+		}
+	}
+
+	if source != "" {
+		return inferFromSource(pi, source)
+	}
+
+	b, err := os.ReadFile(pluginFile)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(b, []byte("PluginWrapper\x00")) {
+		return nil, fmt.Errorf("%s has no PluginWrapper, not a plugin built by fgpk", pluginFile)
+	}
+	for i, fn := range convention.PluginFunNames {
+		if hasMainSymbol(b, mainPaths, fn) {
+			pi.Type = convention.PluginTypes[i]
+			break
+		}
+	}
+	// IterIndex可能被内联，但IterLen是iterator插件独有的
+	if pi.Type == "" && hasMainSymbol(b, mainPaths, convention.PluginMinorFun[convention.IndPTypeIteratorMinor]) {
+		pi.Type = convention.PluginTypes[convention.IndPTypeIterator]
+	}
+	if pi.Type == "" {
+		return nil, errors.New("cannot infer plugin type from the binary, specify the plugin's source with --source")
+	}
+	// 二进制文件中没有自定义参数的信息，只能给出约定的参数
+	for _, p := range convention.GetFuncDecl(pi.Type).Params {
+		pi.Params = append(pi.Params, convention.ParaMeta{Param: p})
+	}
+	return pi, nil
+}
+
+// inferFromSource 从插件源码中获取插件类型以及完整的参数列表
+func inferFromSource(pi *convention.PluginInfo, source string) (*convention.PluginInfo, error) {
+	stat, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{source}
+	if stat.IsDir() {
+		if files, err = goParser.PackageFiles(source, "wrapped.go"); err != nil {
+			return nil, err
+		}
+	}
+	entry, err := ResolvePluginEntry(files)
+	if err != nil {
+		return nil, err
+	}
+	pi.Type = entry.Type
+	pi.Params = entry.ParaMeta
+	pi.ReturnsError = convention.ReturnsError(entry.Type, *entry.Fd)
+	for _, hook := range convention.PluginMinorFun[convention.IndInitMinor:] {
+		if _, _, _, err = goParser.FindFunctionInFiles(files, hook); err == nil {
+			pi.Hooks = append(pi.Hooks, hook)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return pi, ApplyDirectives(pi, files)
+}
+
+// LoadPluginInfo 获取插件元信息：优先静态读取build -i嵌入的信息；读取不到时，若指定了源码则从源码推测，
+// 否则在allowLoad为true时加载插件调用PluginInfo函数，仍然失败则根据二进制文件推测。
+// abi为插件的调用方式，为空时根据构建信息中的-buildmode判断，c-shared方式编译的插件通过dlopen加载
+func LoadPluginInfo(pluginFile string, allowLoad bool, source string, abi string) (*convention.PluginInfo, error) {
+	pi, err := ReadPluginInfoStatic(pluginFile)
+	if err == nil || !errors.Is(err, ErrNoStaticInfo) {
+		return pi, err
+	}
+	if source == "" && allowLoad {
+		if abi == "" && IsCShared(pluginFile) {
+			abi = convention.ABICgo
+		}
+		if abi == convention.ABICgo && runtime.GOOS != "windows" {
+			pi, err = GetCgoPluginInfo(pluginFile)
+		} else if err = PreCheckPlugin(pluginFile); err == nil {
+			pi, err = GetPluginInfo(pluginFile)
+		}
+		if err == nil {
+			return pi, nil
+		}
+		var openErr *PluginOpenError
+		if errors.As(err, &openErr) {
+			return nil, err
+		}
+	}
+	pi, err = InferPluginInfo(pluginFile, source)
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "warning: %s has no PluginInfo, type %s is inferred", pluginFile, pi.Type)
+		if source == "" {
+			fmt.Fprint(os.Stderr, ", custom parameters are unknown(use --source to specify)")
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	return pi, err
+}
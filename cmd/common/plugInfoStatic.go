@@ -0,0 +1,34 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"os"
+)
+
+var ErrNoStaticInfo = errors.New("no embedded PluginInfo found (plugin built without -i or by an older fgpk)")
+
+// ReadPluginInfoStatic 不加载插件，直接从二进制文件（.so、.dll等）中读取build -i嵌入的元信息
+func ReadPluginInfoStatic(pluginFile string) (*convention.PluginInfo, error) {
+	b, err := os.ReadFile(pluginFile)
+	if err != nil {
+		return nil, err
+	}
+	begin := bytes.Index(b, []byte(convention.PlugInfoBegin))
+	if begin == -1 {
+		return nil, ErrNoStaticInfo
+	}
+	b = b[begin+len(convention.PlugInfoBegin):]
+	end := bytes.Index(b, []byte(convention.PlugInfoEnd))
+	if end == -1 {
+		return nil, ErrNoStaticInfo
+	}
+	pi := new(convention.PluginInfo)
+	if err = json.Unmarshal(b[:end], pi); err != nil {
+		return nil, fmt.Errorf("embedded PluginInfo is corrupted: %w", err)
+	}
+	return pi, nil
+}
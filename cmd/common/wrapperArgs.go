@@ -0,0 +1,74 @@
+package common
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"reflect"
+)
+
+// PluginWrapperArgs 按FuzzGIU调用plugin方式插件的方式组装PluginWrapper的参数：结构体类型的预留参数序列化为json，
+// iterator插件在lengths之后插入选择调用IterIndex的参数，args为插件函数的完整实参列表
+func PluginWrapperArgs(pType string, args []any) ([]any, error) {
+	wArgs := make([]any, 0, len(args)+1)
+	for i, a := range args {
+		if i == 1 && pType == convention.PluginTypes[convention.IndPTypeIterator] {
+			wArgs = append(wArgs, int8(0))
+		}
+		if a == nil || reflect.TypeOf(a).Kind() != reflect.Pointer {
+			wArgs = append(wArgs, a)
+			continue
+		}
+		j, err := json.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		wArgs = append(wArgs, j)
+	}
+	return wArgs, nil
+}
+
+// DecodeWrapperResult 将PluginWrapper返回的数据解码为插件函数的返回值，plugin与cgo方式的编码相同
+func DecodeWrapperResult(retType string, b []byte) (any, error) {
+	switch retType {
+	case "string":
+		return string(b), nil
+	case "[]string":
+		// 格式为int32的字符串个数，之后每个字符串为int32长度加内容
+		if len(b) < 4 {
+			return nil, errors.New("truncated payloads")
+		}
+		n := int(int32(binary.LittleEndian.Uint32(b)))
+		strs := make([]string, 0, n)
+		for off := 4; len(strs) < n; {
+			if off+4 > len(b) {
+				return nil, errors.New("truncated payloads")
+			}
+			l := int(int32(binary.LittleEndian.Uint32(b[off:])))
+			if off+4+l > len(b) {
+				return nil, errors.New("truncated payloads")
+			}
+			strs = append(strs, string(b[off+4:off+4+l]))
+			off += 4 + l
+		}
+		return strs, nil
+	case "[]int":
+		// 格式为4字节的头部（cgo方式下为个数，plugin方式下未使用），之后每个下标为8字节
+		if len(b) < 4 || (len(b)-4)%8 != 0 {
+			return nil, fmt.Errorf("malformed indexes of %d bytes", len(b))
+		}
+		ints := make([]int, 0, (len(b)-4)/8)
+		for off := 4; off < len(b); off += 8 {
+			ints = append(ints, int(int64(binary.LittleEndian.Uint64(b[off:]))))
+		}
+		return ints, nil
+	}
+	stru := convention.GetStruct(retType)
+	if stru == nil {
+		return nil, fmt.Errorf("unsupported return type %s", retType)
+	}
+	err := json.Unmarshal(b, stru)
+	return stru, err
+}
@@ -0,0 +1,54 @@
+package compat
+
+import (
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/common"
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "check-compat",
+	Short: "check whether a plugin can be loaded by a FuzzGIU binary",
+	Long: `check whether a plugin can be loaded by a FuzzGIU binary
+	go plugins can only be loaded when the host and the plugin are built with the same
+	go toolchain, the same version of every shared module and the same build settings
+	(build tags, GOEXPERIMENT, etc.). this command reads the build info embedded in both
+	binaries without loading them, reports every mismatch and tells how to fix the
+	plugin's go.mod or build environment.`,
+	Run: runCmdCheckCompat,
+}
+
+func init() {
+	Cmd.Flags().StringP("host", "H", "", "path of FuzzGIU binary")
+	Cmd.Flags().StringP("plugin", "p", "", "path of plugin binary")
+}
+
+func runCmdCheckCompat(cmd *cobra.Command, _ []string) {
+	common.SetCurrentCmd(cmd.Use)
+	host, _ := cmd.Flags().GetString("host")
+	plugin, _ := cmd.Flags().GetString("plugin")
+	if host == "" || plugin == "" {
+		common.FailExit("missing host(--host) or plugin(--plugin) path")
+	}
+
+	hostInfo, err := common.ReadBuildInfo(host)
+	if err != nil {
+		common.FailExit(fmt.Errorf("read build info of %s failed: %w", host, err))
+	}
+	pluginInfo, err := common.ReadBuildInfo(plugin)
+	if err != nil {
+		common.FailExit(fmt.Errorf("read build info of %s failed: %w", plugin, err))
+	}
+	fmt.Printf("%-7s: %s (%s)\n", "host", host, hostInfo.GoVersion)
+	fmt.Printf("%-7s: %s (%s)\n", "plugin", plugin, pluginInfo.GoVersion)
+
+	mismatches := common.CompareBuildInfo(hostInfo, pluginInfo)
+	if len(mismatches) == 0 {
+		fmt.Println("compatible: no mismatch found")
+		return
+	}
+	for _, m := range mismatches {
+		fmt.Printf("[x] %s\n    fix: %s\n", m, m.Fix)
+	}
+	common.FailExit(fmt.Sprintf("%d mismatch(es) found, plugin cannot be loaded by host", len(mismatches)))
+}
@@ -0,0 +1,139 @@
+package fix
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/common"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"github.com/nostalgist134/FuzzGIUPluginKit/env"
+	"github.com/nostalgist134/FuzzGIUPluginKit/goParser"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "fix",
+	Short: "rewrite plugin function signatures to follow the convention",
+	Long: `rewrite plugin function signatures to follow the convention
+	the plugin function(and IterLen of iterator plugins) is rewritten by its syntax tree:
+	conventional params are moved to the front of the param list and renamed to their
+	conventional names(references in the function body are renamed too), missing ones
+	are inserted, the return type is corrected and the fuzzTypes import is added when
+	needed. the changes are printed as a unified diff, use -w to apply them in place.
+	return statements and unsupported custom param types can't be fixed automatically.`,
+	Run: runCmdFix,
+}
+
+func init() {
+	Cmd.Flags().StringP("path", "p", "", "path/file of plugin source")
+	Cmd.Flags().BoolP("write", "w", false, "write the fixed source back to the files")
+}
+
+// defaultFuzzTypesImport 项目中没有fuzzTypes副本时使用的fuzzTypes包
+const defaultFuzzTypesImport = "github.com/nostalgist134/FuzzGIU/components/fuzzTypes"
+
+// fuzzTypesImport 返回插件应导入的fuzzTypes包：fgpk gen生成的项目中使用模块内components/fuzzTypes的副本
+func fuzzTypesImport(srcDir string) string {
+	modRoot := env.FindModRoot(srcDir)
+	if modRoot == "" {
+		return defaultFuzzTypesImport
+	}
+	modPath := env.ModulePath(modRoot)
+	if fi, err := os.Stat(filepath.Join(modRoot, "components", "fuzzTypes")); err == nil && fi.IsDir() &&
+		modPath != "" {
+		return modPath + "/components/fuzzTypes"
+	}
+	return defaultFuzzTypesImport
+}
+
+// fixTarget 需要改写的函数
+type fixTarget struct {
+	file        string
+	funName     string
+	correctFd   convention.FuncDecl
+	allowCustom bool
+}
+
+func displayPath(p string) string {
+	if rel, err := filepath.Rel(env.GetCwd(), p); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(p)
+}
+
+func runCmdFix(cmd *cobra.Command, _ []string) {
+	common.SetCurrentCmd(cmd.Use)
+	path, _ := cmd.Flags().GetString("path")
+	write, _ := cmd.Flags().GetBool("write")
+	if path == "" {
+		common.FailExit("missing plugin source path/file")
+	}
+	stat, err := os.Stat(path)
+	common.FailExit(err)
+	files := []string{path}
+	srcDir := filepath.Dir(path)
+	if stat.IsDir() {
+		srcDir = path
+		files, err = goParser.PackageFiles(path, "wrapped.go")
+		common.FailExit(err)
+	}
+
+	entry, err := common.ResolvePluginEntry(files)
+	common.FailExit(err)
+	targets := []fixTarget{{entry.File, entry.FunName, convention.PluginFunDecl(entry.Type, *entry.Fd), true}}
+	if entry.Type == convention.PluginTypes[convention.IndPTypeIterator] {
+		minorFun := convention.PluginMinorFun[convention.IndPTypeIteratorMinor]
+		_, _, minorFile, err := goParser.FindFunctionInFiles(files, minorFun)
+		if err == nil {
+			// IterLen在lengths之后接收与插件函数相同的自定义参数
+			targets = append(targets, fixTarget{minorFile, minorFun,
+				convention.MinorFunDecl(entry.Type, minorFun, *entry.Fd), true})
+		} else if !errors.Is(err, os.ErrNotExist) {
+			common.FailExit(err)
+		}
+	}
+
+	// 同一文件中的多个函数依次改写，每次改写都基于上一次的结果
+	fixed := make(map[string][]byte)
+	original := make(map[string][]byte)
+	order := make([]string, 0)
+	impPath := fuzzTypesImport(srcDir)
+	noted := 0
+	for _, t := range targets {
+		fa, err := goParser.FindFuncAST(t.file, fixed[t.file], t.funName)
+		common.FailExit(err)
+		if _, ok := original[t.file]; !ok {
+			original[t.file] = fa.Src
+			order = append(order, t.file)
+		}
+		out, notes, err := fixFunction(fa, t.correctFd, t.allowCustom, impPath)
+		common.FailExit(err)
+		fixed[t.file] = out
+		for _, n := range notes {
+			fmt.Fprintln(os.Stderr, "fix: "+n)
+		}
+		noted += len(notes)
+	}
+
+	changed := 0
+	for _, f := range order {
+		name := displayPath(f)
+		diff := unifiedDiff("a/"+name, "b/"+name, string(original[f]), string(fixed[f]))
+		if diff == "" {
+			continue
+		}
+		changed++
+		if write {
+			common.FailExit(os.WriteFile(f, fixed[f], 0644))
+			fmt.Printf("fixed %s\n", name)
+		} else {
+			fmt.Print(diff)
+		}
+	}
+	if changed == 0 && noted > 0 {
+		fmt.Fprintln(os.Stderr, "nothing can be fixed automatically")
+	} else if changed == 0 {
+		fmt.Fprintln(os.Stderr, "nothing to fix, signatures already follow the convention")
+	}
+}
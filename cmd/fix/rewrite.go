@@ -0,0 +1,377 @@
+package fix
+
+import (
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"github.com/nostalgist134/FuzzGIUPluginKit/goParser"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// edit 对源码的一处文本替换，[start, end)为被替换的字节范围
+type edit struct {
+	start, end int
+	text       string
+}
+
+func applyEdits(src []byte, edits []edit) []byte {
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	out := slices.Clone(src)
+	for _, e := range edits {
+		out = slices.Concat(out[:e.start], []byte(e.text), out[e.end:])
+	}
+	return out
+}
+
+// srcParam 源码中的一个参数
+type srcParam struct {
+	ident *ast.Ident // 匿名参数为nil
+	name  string
+	typ   string // 规范化的类型字符串，用于与约定比较
+	text  string // 类型在源码中的文本（包括参数名与类型之间的INFO等注解注释）
+	used  bool
+}
+
+// flattenParams 将参数列表展开为每个参数一项（a, b int展开为两项）
+func flattenParams(fa *goParser.FuncAST) ([]*srcParam, error) {
+	params := make([]*srcParam, 0)
+	for _, field := range fa.Decl.Type.Params.List {
+		typ, err := fa.TypeString(field.Type)
+		if err != nil {
+			return nil, err
+		}
+		if len(field.Names) == 0 {
+			params = append(params, &srcParam{typ: typ, text: fa.Text(field.Type)})
+			continue
+		}
+		// 参数名与类型之间可能有INFO等注解注释，一起保留
+		last := field.Names[len(field.Names)-1]
+		text := strings.TrimSpace(string(fa.Src[fa.Offset(last.End()):fa.Offset(field.Type.End())]))
+		for _, name := range field.Names {
+			params = append(params, &srcParam{ident: name, name: name.Name, typ: typ, text: text})
+		}
+	}
+	return params, nil
+}
+
+// takeParam 取出第一个未使用的、类型为typ的参数，同名的参数优先
+func takeParam(params []*srcParam, name, typ string) *srcParam {
+	var found *srcParam
+	for _, p := range params {
+		if p.used || p.typ != typ {
+			continue
+		}
+		if p.name == name {
+			found = p
+			break
+		}
+		if found == nil {
+			found = p
+		}
+	}
+	if found != nil {
+		found.used = true
+	}
+	return found
+}
+
+// fixer 将一个函数的声明改写为符合约定的形式
+type fixer struct {
+	fa      *goParser.FuncAST
+	edits   []edit
+	notes   []string
+	warns   []string // 无法自动修复的问题，即使没有修改也要输出
+	renames map[*ast.Object]string
+	pkgName string // 文件中fuzzTypes包的导入名
+}
+
+// referencedIn 判断参数是否在函数体中被引用
+func (f *fixer) referencedIn(p *srcParam) bool {
+	if p.ident == nil || p.ident.Obj == nil || f.fa.Decl.Body == nil {
+		return false
+	}
+	found := false
+	ast.Inspect(f.fa.Decl.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id != p.ident && id.Obj == p.ident.Obj {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// checkRename 检查将参数重命名为newName是否会与函数体中的其它标识符冲突
+func (f *fixer) checkRename(p *srcParam, newName string) error {
+	if f.fa.Decl.Body == nil {
+		return nil
+	}
+	selectors := make(map[*ast.Ident]bool)
+	var conflict *ast.Ident
+	ast.Inspect(f.fa.Decl.Body, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			selectors[x.Sel] = true
+		case *ast.KeyValueExpr:
+			if id, ok := x.Key.(*ast.Ident); ok && id.Obj == nil {
+				selectors[id] = true // 结构体字面量的字段名
+			}
+		case *ast.Ident:
+			if x.Name == newName && !selectors[x] && (p.ident == nil || x.Obj != p.ident.Obj) {
+				conflict = x
+			}
+		}
+		return conflict == nil
+	})
+	if conflict != nil {
+		return fmt.Errorf("%s: cannot rename %q to %q, the name is already used in the function body",
+			f.fa.Fset.Position(conflict.Pos()), p.name, newName)
+	}
+	return nil
+}
+
+// renameRefs 将函数体中对参数的引用替换为新名字
+func (f *fixer) renameRefs() {
+	if f.fa.Decl.Body == nil || len(f.renames) == 0 {
+		return
+	}
+	ast.Inspect(f.fa.Decl.Body, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || id.Obj == nil {
+			return true
+		}
+		if newName, ok := f.renames[id.Obj]; ok {
+			f.edits = append(f.edits, edit{f.fa.Offset(id.Pos()), f.fa.Offset(id.End()), newName})
+		}
+		return true
+	})
+}
+
+// fixParams 重排、重命名并补全参数列表
+func (f *fixer) fixParams(funName string, correctFd convention.FuncDecl, allowCustom bool) error {
+	params, err := flattenParams(f.fa)
+	if err != nil {
+		return err
+	}
+	paraList := make([]string, 0, len(params))
+	taken := make(map[string]bool)
+	// 参数列表只在有修改时才改写，避免改变已经符合约定的代码的写法（如a, b int）
+	changed := false
+	order := make([]*srcParam, 0, len(params))
+
+	// 约定的参数必须位于参数列表开头，已有的同类型参数会被移动到对应位置并重命名，缺少的则被插入
+	for _, cp := range correctFd.Params {
+		taken[cp.Name] = true
+		p := takeParam(params, cp.Name, cp.Type)
+		if p == nil {
+			f.notes = append(f.notes, fmt.Sprintf("%s: inserted param %s %s", funName, cp.Name, f.qualify(cp.Type)))
+			paraList = append(paraList, cp.Name+" "+f.qualify(cp.Type))
+			changed = true
+			continue
+		}
+		order = append(order, p)
+		if p.name != cp.Name {
+			changed = true
+			if err := f.checkRename(p, cp.Name); err != nil {
+				return err
+			}
+			if p.ident != nil && p.ident.Obj != nil && p.name != "_" {
+				f.renames[p.ident.Obj] = cp.Name
+			}
+			f.notes = append(f.notes, fmt.Sprintf("%s: renamed param %q to %q", funName, p.name, cp.Name))
+		}
+		paraList = append(paraList, cp.Name+" "+p.text)
+	}
+
+	// 其余参数作为自定义参数，保持原有顺序
+	for i, p := range params {
+		if p.used {
+			continue
+		}
+		if !allowCustom {
+			if f.referencedIn(p) {
+				return fmt.Errorf("%s: %s accepts no custom params, but param %q is used in the function body",
+					f.fa.Fset.Position(p.ident.Pos()), funName, p.name)
+			}
+			f.notes = append(f.notes, fmt.Sprintf("%s: removed unused param %q", funName, p.name))
+			changed = true
+			continue
+		}
+		order = append(order, p)
+		name := p.name
+		if name == "" || name == "_" || taken[name] {
+			name = fmt.Sprintf("arg%d", i)
+			for taken[name] {
+				name += "_"
+			}
+			if p.name != "" && p.name != "_" {
+				if err := f.checkRename(p, name); err != nil {
+					return err
+				}
+				f.renames[p.ident.Obj] = name
+			}
+			f.notes = append(f.notes, fmt.Sprintf("%s: named custom param %d %q", funName, i, name))
+			changed = true
+		}
+		taken[name] = true
+		// 不知道插件会以哪种方式编译，任一ABI不支持的类型都需要提示
+		unsupported := make([]string, 0)
+		for _, abi := range []string{convention.ABIPlugin, convention.ABICgo} {
+			if !slices.Contains(convention.CustomParamTypes[abi], p.typ) {
+				unsupported = append(unsupported, abi)
+			}
+		}
+		if len(unsupported) > 0 {
+			f.warns = append(f.warns, fmt.Sprintf("%s: custom param %q has type %s, which can't be passed through "+
+				"the %s ABI, fix it by hand", funName, name, p.typ, strings.Join(unsupported, "/")))
+		}
+		paraList = append(paraList, name+" "+p.text)
+	}
+
+	for i, p := range order {
+		if p != params[i] {
+			changed = true
+			f.notes = append(f.notes, fmt.Sprintf("%s: moved conventional params to the front", funName))
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+	pl := f.fa.Decl.Type.Params
+	f.edits = append(f.edits, edit{f.fa.Offset(pl.Opening) + 1, f.fa.Offset(pl.Closing),
+		strings.Join(paraList, ", ")})
+	return nil
+}
+
+// fixResults 修正返回类型
+func (f *fixer) fixResults(funName string, correctFd convention.FuncDecl) {
+	want := f.qualify(correctFd.RetType)
+	if strings.Contains(want, ",") {
+		want = "(" + want + ")"
+	}
+	res := f.fa.Decl.Type.Results
+	if res == nil || len(res.List) == 0 {
+		end := f.fa.Offset(f.fa.Decl.Type.Params.Closing) + 1
+		f.edits = append(f.edits, edit{end, end, " " + want})
+		f.notes = append(f.notes, fmt.Sprintf("%s: added return type %s, return statements need to be "+
+			"updated by hand", funName, want))
+		return
+	}
+	given := make([]string, 0, len(res.List))
+	for _, field := range res.List {
+		typ, err := f.fa.TypeString(field.Type)
+		if err != nil {
+			typ = types.ExprString(field.Type)
+		}
+		for i := 0; i < max(len(field.Names), 1); i++ {
+			given = append(given, typ)
+		}
+	}
+	if strings.Join(given, ", ") == correctFd.RetType {
+		return
+	}
+	f.edits = append(f.edits, edit{f.fa.Offset(res.Pos()), f.fa.Offset(res.End()), want})
+	f.notes = append(f.notes, fmt.Sprintf("%s: changed return type %s to %s, return statements may need to "+
+		"be updated by hand", funName, f.fa.Text(res), want))
+}
+
+// fuzzTypesName 返回文件导入fuzzTypes包时使用的包名（可能是别名），优先匹配导入路径为path的import，
+// 其次是其它路径最后一段为fuzzTypes的import。没有可用的import时返回false
+func fuzzTypesName(file *ast.File, path string) (string, bool) {
+	name, found := "", false
+	for _, imp := range file.Imports {
+		impPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || impPath[strings.LastIndex(impPath, "/")+1:] != "fuzzTypes" {
+			continue
+		}
+		local := "fuzzTypes"
+		if imp.Name != nil {
+			local = imp.Name.Name
+		}
+		// 匿名导入与点导入无法用于限定类型名
+		if local == "_" || local == "." {
+			continue
+		}
+		if impPath == path {
+			return local, true
+		}
+		if !found {
+			name, found = local, true
+		}
+	}
+	return name, found
+}
+
+// qualify 将约定中以fuzzTypes限定的类型改为以文件中fuzzTypes包的导入名限定
+func (f *fixer) qualify(typ string) string {
+	if f.pkgName == "fuzzTypes" {
+		return typ
+	}
+	return strings.ReplaceAll(typ, "fuzzTypes.", f.pkgName+".")
+}
+
+// addImport 添加import语句，已有import块时加入其中，已有单独的import语句时将其改写为import块，否则在package语句后新增
+func (f *fixer) addImport(path string) {
+	quoted := strconv.Quote(path)
+	f.notes = append(f.notes, "added import "+quoted)
+	for _, decl := range f.fa.File.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+		if gd.Lparen.IsValid() {
+			pos := f.fa.Offset(gd.Rparen)
+			f.edits = append(f.edits, edit{pos, pos, "\t" + quoted + "\n"})
+		} else {
+			f.edits = append(f.edits, edit{f.fa.Offset(gd.Pos()), f.fa.Offset(gd.End()),
+				"import (\n\t" + f.fa.Text(gd.Specs[0]) + "\n\t" + quoted + "\n)"})
+		}
+		return
+	}
+	pos := f.fa.Offset(f.fa.File.Name.End())
+	f.edits = append(f.edits, edit{pos, pos, "\n\nimport " + quoted})
+}
+
+// fixFunction 改写函数声明使其符合约定，返回改写后的源码与所做修改的说明
+func fixFunction(fa *goParser.FuncAST, correctFd convention.FuncDecl, allowCustom bool,
+	fuzzTypesImport string) ([]byte, []string, error) {
+	funName := fa.Decl.Name.Name
+	// 文件已经导入fuzzTypes时沿用其导入名（可能是别名），否则添加import
+	pkgName, imported := fuzzTypesName(fa.File, fuzzTypesImport)
+	if !imported {
+		pkgName = "fuzzTypes"
+	}
+	f := &fixer{fa: fa, renames: make(map[*ast.Object]string), pkgName: pkgName}
+	if err := f.fixParams(funName, correctFd, allowCustom); err != nil {
+		return nil, nil, err
+	}
+	f.fixResults(funName, correctFd)
+	f.renameRefs()
+
+	needFuzzTypes := strings.Contains(correctFd.RetType, "fuzzTypes.")
+	for _, p := range correctFd.Params {
+		needFuzzTypes = needFuzzTypes || strings.Contains(p.Type, "fuzzTypes.")
+	}
+	if needFuzzTypes && !imported {
+		f.addImport(fuzzTypesImport)
+	}
+
+	fixed := applyEdits(fa.Src, f.edits)
+	formatted, err := format.Source(fixed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("format fixed source failed: %w", err)
+	}
+	// 格式化后与原文件相同，则没有任何修改
+	if string(formatted) == string(fa.Src) {
+		return formatted, f.warns, nil
+	}
+	return formatted, append(f.notes, f.warns...), nil
+}
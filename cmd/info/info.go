@@ -7,17 +7,28 @@ import (
 	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
 	"github.com/spf13/cobra"
 	"os"
+	"strings"
 )
 
 var Cmd = &cobra.Command{
 	Use:   "info",
 	Short: "get plugin information",
-	Run:   runCmdInfo,
+	Long: `get plugin information
+	the information embedded by build -i is read directly from the plugin file(.so, .dll, etc.)
+	without loading or executing it. plugins built by older versions of fgpk only provide the
+	information through their PluginInfo function, use -l to load them. for plugins without any
+	PluginInfo(built without -i), the plugin type and go version are inferred from the binary,
+	use --source to get the full parameter list from the plugin's source.`,
+	Run: runCmdInfo,
 }
 
 func init() {
 	Cmd.Flags().StringP("path", "p", "", "plugin binary path")
 	Cmd.Flags().StringP("format", "f", "", "output format(native, json)")
+	Cmd.Flags().BoolP("load", "l", false, "load the plugin and call its PluginInfo when the "+
+		"information cannot be read statically")
+	Cmd.Flags().String("source", "", "plugin source file or directory, used when the plugin has no "+
+		"PluginInfo")
 }
 
 func outputPluginInfo(info *convention.PluginInfo, format string) {
@@ -31,6 +42,12 @@ func outputPluginInfo(info *convention.PluginInfo, format string) {
 	}
 	formattedOut("plugin", info.Name)
 	formattedOut("plugin type", info.Type)
+	if info.Version != "" {
+		formattedOut("version", info.Version)
+	}
+	if len(info.Requires) > 0 {
+		formattedOut("requires", strings.Join(info.Requires, "; "))
+	}
 	formattedOut("go version", info.GoVersion)
 	formattedOut("usage", info.UsageInfo)
 	fmt.Printf("parameters >")
@@ -42,8 +59,42 @@ func outputPluginInfo(info *convention.PluginInfo, format string) {
 		if pm.ParaInfo != "" {
 			fmt.Printf(" - \"%s\"", pm.ParaInfo)
 		}
+		if pm.Annotated() {
+			fmt.Printf(" [%s]", pm.AnnotationString())
+		}
 		os.Stdout.Write([]byte{'\n'})
 	}
+	if info.ReturnsError {
+		formattedOut("returns error", "yes")
+	}
+	if len(info.Hooks) > 0 {
+		formattedOut("hooks", strings.Join(info.Hooks, ", "))
+	}
+	if info.Build == nil {
+		return
+	}
+	b := info.Build
+	fmt.Println("build >")
+	buildOut := func(title string, content any) {
+		fmt.Printf("        %-13s: %v\n", title, content)
+	}
+	buildOut("fgpk version", b.FgpkVersion)
+	buildOut("time", b.Time)
+	buildOut("host", b.HostOS+"/"+b.HostArch)
+	if b.Revision != "" {
+		rev := b.VCS + " " + b.Revision
+		if b.Dirty {
+			rev += " (dirty)"
+		}
+		buildOut("revision", rev)
+	}
+	buildOut("source hash", b.SourceHash)
+	if len(b.Modules) > 0 {
+		buildOut("modules", b.Modules[0])
+		for _, m := range b.Modules[1:] {
+			fmt.Printf("        %-13s  %s\n", "", m)
+		}
+	}
 }
 
 func runCmdInfo(cmd *cobra.Command, _ []string) {
@@ -52,8 +103,14 @@ func runCmdInfo(cmd *cobra.Command, _ []string) {
 	if path == "" {
 		common.FailExit("missing plugin path")
 	}
-	pi, err := common.GetPluginInfo(path)
+	// 默认只从文件中静态读取元信息，不加载（执行）插件
+	load, _ := cmd.Flags().GetBool("load")
+	source, _ := cmd.Flags().GetString("source")
+	pi, err := common.LoadPluginInfo(path, load, source, "")
 	common.FailExit(err)
+	if err = common.CheckRequires(pi); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
 	format, _ := cmd.Flags().GetString("format")
 	outputPluginInfo(pi, format)
 }
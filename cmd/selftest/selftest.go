@@ -0,0 +1,206 @@
+package selftest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/common"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"github.com/nostalgist134/FuzzGIUPluginKit/env"
+	"github.com/spf13/cobra"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "build and call the wrapper of every plugin type in every ABI",
+	Long: `build and call the wrapper of every plugin type in every ABI
+	for each plugin type a sample project is generated by gen, then built as a go plugin
+	(-buildmode=plugin) and as a cgo library (-buildmode=c-shared, the ABI used on windows).
+	each built wrapper is called once, and a matrix of the results is printed.`,
+	Run: runCmdSelftest,
+}
+
+func init() {
+	Cmd.Flags().StringP("go-path", "g", "", "go binary path")
+	Cmd.Flags().BoolP("no-clean", "k", false, "keep the generated projects and plugins")
+}
+
+// 自测各阶段的结果
+const (
+	resPass = "pass"
+	resFail = "FAIL"
+	resSkip = "skip"
+)
+
+// cell 自测矩阵中的一项：一种插件类型在一种调用方式下的结果
+type cell struct {
+	pType  string
+	abi    string
+	result string
+	stage  string // 失败或跳过的阶段（gen、build、call）
+	err    error
+	output string // 失败的子命令的输出
+}
+
+// runFgpk 以子进程运行fgpk的子命令，子命令失败时会直接退出，因此不能在当前进程中调用
+func runFgpk(args ...string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	c := exec.Command(exe, append(args, "--non-interactive")...)
+	output, err := c.CombinedOutput()
+	return string(output), err
+}
+
+// sampleArgs 调用样例插件的实参，与test run使用的预留参数相同
+func sampleArgs(pType string) []any {
+	if pType == convention.PluginTypes[convention.IndPTypePlProc] {
+		return []any{"fgpk selftest"}
+	}
+	return convention.GetContextArgs(pType)
+}
+
+// callWrapper 调用样例插件的包装函数一次，并检查返回的数据能否解码为插件函数的返回值
+func callWrapper(c *cell, out string) {
+	var (
+		b   []byte
+		err error
+	)
+	args := sampleArgs(c.pType)
+	if c.abi == convention.ABIPlugin {
+		var wArgs []any
+		if wArgs, err = common.PluginWrapperArgs(c.pType, args); err == nil {
+			b, err = common.CallPluginWrapper(out, wArgs...)
+		}
+	} else {
+		b, err = common.CallCgoWrapper(out, c.pType, args)
+	}
+	if err == nil {
+		_, err = common.DecodeWrapperResult(convention.GetFuncDecl(c.pType).RetType, b)
+	}
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		c.result, c.stage, c.err = resSkip, "call", fmt.Errorf("%s plugins can't be loaded on this system", c.abi)
+	case err != nil:
+		c.result, c.stage, c.err = resFail, "call", err
+	default:
+		c.result = resPass
+	}
+}
+
+// runCell 编译样例插件并调用其包装函数
+func runCell(c *cell, projDir string, goPath string, env1 env.Env) {
+	if c.abi == convention.ABIPlugin && env1.OS == "windows" {
+		c.result, c.stage, c.err = resSkip, "build", errors.New("go plugins are not supported on windows")
+		return
+	}
+	out := filepath.Join(projDir, fmt.Sprintf("%s.%s%s", c.pType, c.abi, env1.BinSuffix))
+	buildArgs := []string{"build", "-p", projDir, "-o", out, "-i", "--abi", c.abi}
+	if goPath != "" {
+		buildArgs = append(buildArgs, "-g", goPath)
+	}
+	output, err := runFgpk(buildArgs...)
+	if err != nil {
+		c.result, c.stage, c.err, c.output = resFail, "build", err, output
+		return
+	}
+	callWrapper(c, out)
+}
+
+// lastLines 返回输出的最后n行
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func printMatrix(cells []cell, abis []string) {
+	fmt.Printf("\n%-14s", "plugin type")
+	for _, abi := range abis {
+		fmt.Printf("%-8s", abi)
+	}
+	fmt.Println()
+	for i := 0; i < len(cells); i += len(abis) {
+		fmt.Printf("%-14s", cells[i].pType)
+		for _, c := range cells[i : i+len(abis)] {
+			fmt.Printf("%-8s", c.result)
+		}
+		fmt.Println()
+	}
+	for _, c := range cells {
+		if c.result == resPass {
+			continue
+		}
+		fmt.Printf("\n[%s] %s (%s), %s: %v\n", c.result, c.pType, c.abi, c.stage, c.err)
+		if c.output != "" {
+			fmt.Println(lastLines(c.output, 20))
+		}
+	}
+}
+
+func runCmdSelftest(cmd *cobra.Command, _ []string) {
+	common.SetCurrentCmd(cmd.Use)
+	// 未指定go编译器时，build子命令同样使用$PATH中的go
+	goPath, _ := cmd.Flags().GetString("go-path")
+	checkPath := goPath
+	if checkPath == "" {
+		checkPath = "go"
+	}
+	env1 := env.Check(checkPath)
+	if !env1.OkToBuild {
+		common.FailExit("environment check failed")
+	}
+
+	// 所有样例项目与编译产物都放在临时目录中
+	ws, err := env.NewWorkspace()
+	common.FailExit(err)
+	noClean, _ := cmd.Flags().GetBool("no-clean")
+	cleanWorkspace := func() {
+		if noClean {
+			fmt.Printf("generated projects and plugins are kept in %s\n", ws.Dir)
+			return
+		}
+		if err := ws.Remove(); err != nil {
+			fmt.Printf("remove %s failed: %v\n", ws.Dir, err)
+		}
+	}
+	common.SetExitDefer(cleanWorkspace)
+	defer cleanWorkspace()
+	common.ExitOnInterrupt()
+
+	abis := []string{convention.ABIPlugin, convention.ABICgo}
+	cells := make([]cell, 0, len(convention.PluginTypes)*len(abis))
+	for _, pType := range convention.PluginTypes {
+		// 样例项目由gen生成，插件函数为convention.GenCodePType生成的代码骨架
+		projDir := ws.Path(pType)
+		fmt.Printf("generating %s sample project\n", pType)
+		output, genErr := runFgpk("gen", "-t", pType, "-d", projDir, "-n")
+		for _, abi := range abis {
+			c := cell{pType: pType, abi: abi}
+			if genErr != nil {
+				c.result, c.stage, c.err, c.output = resFail, "gen", genErr, output
+			} else {
+				fmt.Printf("building and calling %s (%s)\n", pType, abi)
+				runCell(&c, projDir, goPath, env1)
+			}
+			cells = append(cells, c)
+		}
+	}
+
+	printMatrix(cells, abis)
+	failed := 0
+	for _, c := range cells {
+		if c.result == resFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		common.FailExit(fmt.Sprintf("%d of %d checks failed", failed, len(cells)))
+	}
+}
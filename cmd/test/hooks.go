@@ -0,0 +1,68 @@
+package test
+
+import (
+	"fmt"
+	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/common"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"strings"
+)
+
+// hookCheck 记录调用插件时使用过的自定义实参，测试结束后据此检查插件的生命周期函数
+type hookCheck struct {
+	tuples  map[string]bool
+	coerced bool // 存在由PluginWrapper转换类型的实参，无法得知转换后的值是否相同
+}
+
+var hooks = hookCheck{tuples: make(map[string]bool)}
+
+// record 记录一次调用的完整实参列表，coerced表示其中有需要由PluginWrapper转换类型的实参
+func (h *hookCheck) record(pType string, args []any, coerced bool) {
+	ctxNum := min(len(convention.GetFuncDecl(pType).Params), len(args))
+	h.tuples[fmt.Sprintf("%#v", args[ctxNum:])] = true
+	h.coerced = h.coerced || coerced
+}
+
+// initCalls 返回插件的Init实际被调用的次数
+func initCalls(pluginPath string) (int, error) {
+	if testABI == convention.ABICgo {
+		return common.CgoInitCalls(pluginPath)
+	}
+	return common.PluginInitCalls(pluginPath)
+}
+
+// closePlugin 调用插件的Close函数
+func closePlugin(pluginPath string) error {
+	if testABI == convention.ABICgo {
+		return common.CgoClosePlugin(pluginPath)
+	}
+	return common.ClosePlugin(pluginPath)
+}
+
+// verifyHooks 检查定义了生命周期函数的插件：Init应当对每组不同的自定义实参恰好调用一次，之后调用Close应当成功
+func verifyHooks(pluginPath string, inf *convention.PluginInfo) {
+	if len(inf.Hooks) == 0 {
+		return
+	}
+	fmt.Println(strings.Repeat("-", 25))
+	fmt.Printf("test on: lifecycle hooks %s\n", strings.Join(inf.Hooks, ", "))
+	calls, err := initCalls(pluginPath)
+	distinct := len(hooks.tuples)
+	switch {
+	case err != nil:
+		fmt.Printf("error: can't get the number of Init calls: %v\n", err)
+	case calls == distinct || (hooks.coerced && calls <= distinct):
+		fmt.Printf("Init called %d times for %d distinct argument tuples\n", calls, distinct)
+		fmt.Println("passed")
+	default:
+		fmt.Printf("Init called %d times for %d distinct argument tuples, wanted exactly once per tuple\n",
+			calls, distinct)
+		fmt.Println("failed")
+	}
+	if err = closePlugin(pluginPath); err != nil {
+		fmt.Printf("error: Close: %v\n", err)
+		fmt.Println("failed")
+		return
+	}
+	fmt.Println("Close returned")
+	fmt.Println("passed")
+}
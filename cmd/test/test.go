@@ -1,18 +1,28 @@
 package test
 
 import (
+	"fmt"
 	"github.com/spf13/cobra"
 )
 
 var Cmd = &cobra.Command{
 	Use: "test",
-	Short: "test a plugin's functionality. this command expect plugin tested be\n" +
-		"built with PluginInfo(-i of build command)",
+	Short: "test a plugin's functionality. plugins built without PluginInfo(-i of build command)\n" +
+		"need --source to provide the parameter list",
 }
 
 type Test struct {
-	Args   []any `json:"args,omitempty"`   // 测试参数列表
-	Expect any   `json:"expect,omitempty"` // 期望返回值
+	Args      []any   `json:"args,omitempty"`         // 测试参数列表
+	Expect    any     `json:"expect,omitempty"`       // 期望返回值
+	ExpectErr *string `json:"expect_error,omitempty"` // 期望插件返回错误，为空字符串时任何错误都符合，否则错误信息须包含此内容
+}
+
+// String 输出测试参数与期望，设置了expect_error时输出期望的错误信息而非指针
+func (t Test) String() string {
+	if t.ExpectErr != nil {
+		return fmt.Sprintf("{%v error(%q)}", t.Args, *t.ExpectErr)
+	}
+	return fmt.Sprintf("{%v %v}", t.Args, t.Expect)
 }
 
 type ResultTest struct {
@@ -24,4 +34,5 @@ type ResultTest struct {
 func init() {
 	Cmd.AddCommand(subCmdRun)
 	Cmd.AddCommand(subCmdGen)
+	Cmd.AddCommand(subCmdAbi)
 }
@@ -0,0 +1,373 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	FGPlugin "github.com/nostalgist134/FuzzGIU/components/plugin"
+	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/common"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"github.com/spf13/cobra"
+	"reflect"
+)
+
+var subCmdAbi = &cobra.Command{
+	Use:   "abi",
+	Short: "check a cgo plugin against the buffer-negotiation protocol",
+	Long: `check a cgo plugin against the buffer-negotiation protocol
+	plugins built with the cgo ABI (the default on windows, build --abi cgo elsewhere) export
+	PluginWrapper and PluginInfo as C functions that take a buffer(dst, dstLen) and:
+	  - return the needed length when dst is nil or dstLen is too short, without writing
+	  - write the output and return its length otherwise
+	  - return ^uintptr(0) on error (for example malformed json arguments)
+	FuzzGIU relies on it with a 640-byte first attempt. this command calls both functions with
+	nil, short, exact and oversized buffers, and PluginWrapper with malformed json arguments,
+	then reports every violation, such as writing past dstLen or returning 0 for non-empty
+	output. custom arguments are specified by a pseudo function call(-e), the same as test run.`,
+	Run: runCmdAbi,
+}
+
+func init() {
+	subCmdAbi.Flags().StringP("path", "p", "", "path of plugin binary file")
+	subCmdAbi.Flags().StringP("expr", "e", "", "pseudo function call providing the arguments "+
+		"after the reserved ones(function name will be ignored)")
+	subCmdAbi.Flags().String("source", "", "plugin source file or directory, used to get the parameter "+
+		"list when the plugin has no PluginInfo")
+}
+
+// abiGuardLen 缓冲区末尾用于检查越界写入的区域长度
+const abiGuardLen = 64
+
+// abiCanary 缓冲区的初始内容，检查时被改写的字节视为被写入
+const abiCanary = 0xa5
+
+// malformedJsons 传给json参数的格式错误的输入
+var malformedJsons = []struct {
+	desc string
+	j    json.RawMessage
+}{
+	{"empty", json.RawMessage("")},
+	{"truncated", json.RawMessage(`{"`)},
+	{"not json", json.RawMessage("fgpk")},
+	{"wrong type", json.RawMessage("[1,2]")},
+}
+
+// abiProbe 一项检查的结果，violation为空表示符合约定
+type abiProbe struct {
+	fun       string
+	probe     string
+	violation string
+	note      string // 不视为违反约定的提示，例如两次调用的输出不同
+}
+
+// abiProber 对一个导出函数进行检查
+type abiProber struct {
+	f      *common.CgoFunc
+	probes []abiProbe
+	decode func([]byte) error // 检查输出能否解码为函数的返回值
+}
+
+func (ap *abiProber) report(probe string, format string, a ...any) {
+	ap.probes = append(ap.probes, abiProbe{fun: ap.f.Name, probe: probe, violation: fmt.Sprintf(format, a...)})
+}
+
+func (ap *abiProber) pass(probe string) {
+	ap.probes = append(ap.probes, abiProbe{fun: ap.f.Name, probe: probe})
+}
+
+func (ap *abiProber) notice(probe string, format string, a ...any) {
+	ap.probes = append(ap.probes, abiProbe{fun: ap.f.Name, probe: probe, note: fmt.Sprintf(format, a...)})
+}
+
+// newCanaryBuf 申请n字节的缓冲区，并在其后附加abiGuardLen字节的检查区域
+func newCanaryBuf(n int) []byte {
+	return bytes.Repeat([]byte{abiCanary}, n+abiGuardLen)
+}
+
+// changedBytes 返回缓冲区从from开始被改写的字节数
+func changedBytes(buf []byte, from int) int {
+	n := 0
+	for _, b := range buf[from:] {
+		if b != abiCanary {
+			n++
+		}
+	}
+	return n
+}
+
+// neededLen 以nil缓冲区调用导出函数，得到输出所需的长度；不符合约定时使用足够大的缓冲区得到输出的长度，仍然失败时ok为false
+func (ap *abiProber) neededLen() (needed int, ok bool) {
+	const probe = "nil dst"
+	ret := ap.f.Call(nil, 0)
+	if ret != common.CgoErr {
+		ap.pass(probe)
+		return int(ret), true
+	}
+	ap.report(probe, "returned the error signal ^uintptr(0), wanted the needed length")
+	buf := newCanaryBuf(1 << 20)
+	if ret = ap.f.Call(buf, 1<<20); ret == common.CgoErr || int(ret) > 1<<20 {
+		ap.report("oversized buffer", "can't get the output with a 1MB buffer either (returned %#x), "+
+			"skipping the other probes", ret)
+		return 0, false
+	}
+	return int(ret), true
+}
+
+// probeEmpty 输出为空（nil缓冲区返回0）时，提供缓冲区的调用同样应当返回0，且不写入任何内容
+func (ap *abiProber) probeEmpty() {
+	const probe = "empty output"
+	buf := newCanaryBuf(common.CgoFirstBufLen)
+	ret := ap.f.Call(buf, len(buf)-abiGuardLen)
+	if w := changedBytes(buf, 0); w > 0 {
+		ap.report(probe, "returned 0 for a nil dst but wrote %d bytes into a %d-byte buffer, "+
+			"returning 0 for non-empty output", w, len(buf)-abiGuardLen)
+		return
+	}
+	if ret != 0 {
+		ap.report(probe, "returned 0 for a nil dst but %#x for a %d-byte buffer", ret, len(buf)-abiGuardLen)
+		return
+	}
+	ap.pass(probe)
+}
+
+// probeExact 使用恰好为所需长度的缓冲区调用，返回写入的输出
+func (ap *abiProber) probeExact(needed int) []byte {
+	const probe = "exact buffer"
+	buf := newCanaryBuf(needed)
+	ret := ap.f.Call(buf, needed)
+	ok := true
+	switch {
+	case ret == 0:
+		ap.report(probe, "returned 0 for non-empty output of %d bytes", needed)
+		ok = false
+	case ret == common.CgoErr:
+		ap.report(probe, "returned the error signal ^uintptr(0), but %d bytes were asked for", needed)
+		ok = false
+	case int(ret) != needed:
+		ap.report(probe, "returned %d, but %d bytes were asked for", ret, needed)
+		ok = false
+	}
+	if w := changedBytes(buf, needed); w > 0 {
+		ap.report(probe, "wrote %d bytes past dstLen", w)
+		ok = false
+	}
+	if ok {
+		ap.pass(probe)
+	}
+	return buf[:needed]
+}
+
+// probeShort 使用比所需长度短的缓冲区（包括长度为0的非空缓冲区）调用，应当返回所需长度且不写入
+func (ap *abiProber) probeShort(needed int) {
+	for _, dstLen := range []int{needed - 1, 0} {
+		probe := fmt.Sprintf("short buffer (%d of %d bytes)", dstLen, needed)
+		buf := newCanaryBuf(needed)
+		ret := ap.f.Call(buf, dstLen)
+		ok := true
+		if int(ret) != needed {
+			ap.report(probe, "returned %#x, wanted the needed length %d", ret, needed)
+			ok = false
+		}
+		if w := changedBytes(buf, 0); w > 0 {
+			ap.report(probe, "wrote %d bytes into a buffer too short for the output", w)
+			ok = false
+		}
+		if ok {
+			ap.pass(probe)
+		}
+	}
+}
+
+// probeOversized 使用比所需长度长的缓冲区调用，应当返回输出的长度，输出与exact的结果相同
+func (ap *abiProber) probeOversized(needed int, exact []byte) {
+	const probe = "oversized buffer"
+	dstLen := needed + abiGuardLen
+	buf := newCanaryBuf(dstLen)
+	ret := ap.f.Call(buf, dstLen)
+	ok := true
+	if int(ret) != needed {
+		ap.report(probe, "returned %#x, wanted the output length %d", ret, needed)
+		ok = false
+	}
+	if w := changedBytes(buf, dstLen); w > 0 {
+		ap.report(probe, "wrote %d bytes past dstLen", w)
+		ok = false
+	}
+	if ok && !bytes.Equal(buf[:needed], exact) {
+		ap.notice(probe, "output differs from the exact-buffer call, the plugin may be nondeterministic")
+		return
+	}
+	if ok {
+		ap.pass(probe)
+	}
+}
+
+// probeFirstAttempt 按FuzzGIU的方式调用：先提供CgoFirstBufLen字节的缓冲区，不足时按返回的长度再调用一次，输出应当能够解码
+func (ap *abiProber) probeFirstAttempt(needed int) {
+	probe := fmt.Sprintf("%d-byte first attempt", common.CgoFirstBufLen)
+	buf := newCanaryBuf(common.CgoFirstBufLen)
+	ret := ap.f.Call(buf, common.CgoFirstBufLen)
+	if int(ret) != needed {
+		ap.report(probe, "returned %#x, wanted %d", ret, needed)
+		return
+	}
+	if needed > common.CgoFirstBufLen {
+		if w := changedBytes(buf, 0); w > 0 {
+			ap.report(probe, "wrote %d bytes although the output needs %d", w, needed)
+			return
+		}
+		buf = newCanaryBuf(needed)
+		ret = ap.f.Call(buf, needed)
+		if int(ret) != needed {
+			ap.report(probe, "second call with %d bytes returned %#x", needed, ret)
+			return
+		}
+	}
+	if err := ap.decode(buf[:needed]); err != nil {
+		ap.report(probe, "output can't be decoded: %v", err)
+		return
+	}
+	ap.pass(probe)
+}
+
+// probeBuffers 依次使用各种缓冲区调用导出函数
+func (ap *abiProber) probeBuffers() {
+	needed, ok := ap.neededLen()
+	if !ok {
+		return
+	}
+	if needed == 0 {
+		ap.probeEmpty()
+		return
+	}
+	exact := ap.probeExact(needed)
+	ap.probeShort(needed)
+	ap.probeOversized(needed, exact)
+	ap.probeFirstAttempt(needed)
+}
+
+// probeMalformedJson 将json参数依次替换为格式错误的输入，PluginWrapper应当返回^uintptr(0)且不写入缓冲区
+func probeMalformedJson(libFile string, pType string, args []any, params []convention.Param) ([]abiProbe, error) {
+	var probes []abiProbe
+	for i, a := range args {
+		if a == nil || reflect.TypeOf(a).Kind() != reflect.Pointer {
+			continue
+		}
+		for _, m := range malformedJsons {
+			malformed := append([]any{}, args...)
+			malformed[i] = m.j
+			f, err := common.OpenCgoFunc(libFile, "PluginWrapper", pType, malformed)
+			if err != nil {
+				return nil, err
+			}
+			p := abiProbe{fun: f.Name, probe: fmt.Sprintf("%s json for %s", m.desc, params[i].Name)}
+			buf := newCanaryBuf(common.CgoFirstBufLen)
+			ret := f.Call(buf, common.CgoFirstBufLen)
+			if ret != common.CgoErr {
+				p.violation = fmt.Sprintf("returned %#x, wanted the error signal ^uintptr(0)", ret)
+			} else if w := changedBytes(buf, 0); w > 0 {
+				p.violation = fmt.Sprintf("returned the error signal but wrote %d bytes", w)
+			}
+			probes = append(probes, p)
+		}
+	}
+	return probes, nil
+}
+
+// probeArgs 被测插件的实参：预留参数使用test run的默认值，其余参数由-e指定，未指定时根据参数类型生成
+func probeArgs(expr string, pType string, params []convention.Param) []any {
+	args := convention.GetContextArgs(pType)
+	ctxArgNum := len(args)
+	if expr != "" {
+		plugins, err := FGPlugin.ParsePluginsStr(expr)
+		common.FailExit(err)
+		if len(plugins) != 1 {
+			common.FailExit("-e should contain exactly one pseudo function call")
+		}
+		args = append(args, plugins[0].Args...)
+		if mismatched, ok := argsMismatch(args, params, ctxArgNum); !ok || len(mismatched) > 0 {
+			common.FailExit("arguments must have the exact types of the plugin's parameters under the cgo ABI")
+		}
+		return args
+	}
+	for _, p := range params[min(ctxArgNum, len(params)):] {
+		switch p.Type {
+		case "string":
+			args = append(args, "fgpk abi probe")
+		case "int":
+			args = append(args, 1)
+		case "bool":
+			args = append(args, true)
+		default:
+			common.FailExit(fmt.Sprintf("can't generate an argument for %s %s, use -e to specify one", p.Name,
+				p.Type))
+		}
+	}
+	return args
+}
+
+func printAbiProbes(probes []abiProbe) int {
+	violations := 0
+	for _, p := range probes {
+		switch {
+		case p.violation != "":
+			violations++
+			fmt.Printf("[x] %s, %s: %s\n", p.fun, p.probe, p.violation)
+		case p.note != "":
+			fmt.Printf("[?] %s, %s: %s\n", p.fun, p.probe, p.note)
+		default:
+			fmt.Printf("[ok] %s, %s\n", p.fun, p.probe)
+		}
+	}
+	return violations
+}
+
+func runCmdAbi(cmd *cobra.Command, _ []string) {
+	common.SetCurrentCmd(Cmd.Use + " " + cmd.Use)
+	path, _ := cmd.Flags().GetString("path")
+	if path == "" {
+		common.FailExit("missing plugin path(-p)")
+	}
+	expr, _ := cmd.Flags().GetString("expr")
+	source, _ := cmd.Flags().GetString("source")
+	inf, err := common.LoadPluginInfo(path, true, source, convention.ABICgo)
+	common.FailExit(err)
+	fd := convention.BuildFd(inf)
+	args := probeArgs(expr, inf.Type, fd.Params)
+
+	var probes []abiProbe
+	// 没有PluginInfo（编译时未指定-i）的插件只检查PluginWrapper
+	if f, err := common.OpenCgoFunc(path, "PluginInfo", "", nil); err == nil {
+		ap := &abiProber{f: f, decode: func(b []byte) error {
+			return json.Unmarshal(b, new(convention.PluginInfo))
+		}}
+		ap.probeBuffers()
+		probes = append(probes, ap.probes...)
+	} else if errors.Is(err, errors.ErrUnsupported) {
+		common.FailExit("cgo plugins can't be loaded by this build of fgpk (cgo is disabled)")
+	} else {
+		var openErr *common.PluginOpenError
+		if errors.As(err, &openErr) {
+			common.FailExit(err)
+		}
+		fmt.Println("PluginInfo is not exported, only PluginWrapper is checked")
+	}
+
+	f, err := common.OpenCgoFunc(path, "PluginWrapper", inf.Type, args)
+	common.FailExit(err)
+	ap := &abiProber{f: f, decode: func(b []byte) error {
+		_, err := common.DecodeWrapperResult(fd.RetType, b)
+		return err
+	}}
+	ap.probeBuffers()
+	probes = append(probes, ap.probes...)
+	malformed, err := probeMalformedJson(path, inf.Type, args, fd.Params)
+	common.FailExit(err)
+	probes = append(probes, malformed...)
+
+	if violations := printAbiProbes(probes); violations > 0 {
+		common.FailExit(fmt.Sprintf("%d violations of the cgo buffer-negotiation protocol found", violations))
+	}
+	fmt.Println("the plugin follows the cgo buffer-negotiation protocol")
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/common"
 	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
 	"github.com/spf13/cobra"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -33,7 +34,12 @@ var subCmdGen = &cobra.Command{
 	treated as test expect source).
 
 	Each file is allowed to contain different numbers of test parameters. program will cycle around 
-	the shorter files(like fuzzGIU's pitchfork-cycle mode)`,
+	the shorter files(like fuzzGIU's pitchfork-cycle mode)
+
+	-b generates boundary cases from the annotations of the plugin's parameters(DEFAULT, MIN, MAX,
+	ENUM, PATTERN): the defaults, the bounds and the values just outside them, every allowed value
+	and one that is not allowed. each case changes one parameter, the others keep their defaults.
+	-b can be used alone or together with -f, in which case the boundary cases are appended.`,
 	Run: runCmdGen,
 }
 
@@ -44,6 +50,10 @@ func init() {
 	subCmdGen.Flags().StringP("struct", "s", "", "marshal structs by type to a "+
 		"file, which can be used as data source file in the future")
 	subCmdGen.Flags().IntP("num", "n", 1, "number of struct to marshal")
+	subCmdGen.Flags().String("source", "", "plugin source file or directory, used to get the parameter "+
+		"list when the plugin has no PluginInfo")
+	subCmdGen.Flags().BoolP("boundary", "b", false, "generate boundary cases from the parameters' "+
+		"annotations(DEFAULT, MIN, MAX, ENUM, PATTERN)")
 }
 
 func tryMarshal(test *Test) error {
@@ -51,29 +61,16 @@ func tryMarshal(test *Test) error {
 	return err
 }
 
-// getUserYN 获取用户输入Yes/No选项
-func getUserYN(prompt string) bool {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Printf("%s (Y/N): ", prompt)
-	line, err := reader.ReadString('\n')
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "failed to get user decision:", err)
-		return false
-	}
-	line = strings.TrimSpace(line)
-	if strings.ToLower(line) == "y" {
-		return true
-	}
-	return false
-}
-
 // tryWrite 尝试写入文件
 func tryWrite(b []byte, fname string) {
 	for {
 		err := os.WriteFile(fname, b, 0644)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "write to %s failed, reason: %v\n", fname, err)
-			if getUserYN("specify a new file?") {
+			if !common.IsInteractive() {
+				common.FailExit(fmt.Sprintf("write to %s failed, specify another out file with -o", fname))
+			}
+			if common.GetUserYN("specify a new file?") {
 				fname = common.ReadInputLine("new file name: ")
 				continue
 			} else {
@@ -257,6 +254,142 @@ func genTestsFiles(fd convention.FuncDecl, fileNames string) ([]*Test, error) {
 	return tests, nil
 }
 
+// boundaryCase 由参数注解得到的一个取值，desc为取值的来源（如min、max+1）
+type boundaryCase struct {
+	val  any
+	desc string
+}
+
+// boundaryValues 根据参数的注解生成边界取值：默认值、最小值与最大值以及超出它们1的值、允许的每个取值以及一个不允许的值，
+// 有正则表达式时加上空字符串。值相同的取值只保留第一个
+func boundaryValues(pm convention.ParaMeta) []boundaryCase {
+	cases := make([]boundaryCase, 0)
+	seen := make(map[string]bool)
+	add := func(lit string, desc string) {
+		v, err := pm.ParseValue(lit)
+		if err != nil || seen[fmt.Sprint(v)] {
+			return
+		}
+		seen[fmt.Sprint(v)] = true
+		cases = append(cases, boundaryCase{val: v, desc: desc})
+	}
+	num := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	if pm.Default != nil {
+		add(*pm.Default, "default")
+	}
+	if pm.Min != nil {
+		add(num(*pm.Min), "min")
+		add(num(*pm.Min-1), "min-1")
+	}
+	if pm.Max != nil {
+		add(num(*pm.Max), "max")
+		add(num(*pm.Max+1), "max+1")
+	}
+	for _, e := range pm.Enum {
+		add(e, "enum")
+	}
+	if len(pm.Enum) > 0 {
+		// 不在允许的取值中的值：字符串为空字符串（或第一个取值加上后缀），数字为最大的取值加1
+		if pm.Param.Type == "string" {
+			if pm.Validate("") != nil {
+				add("", "not in enum")
+			} else {
+				add(pm.Enum[0]+"_", "not in enum")
+			}
+		} else {
+			maxEnum := math.Inf(-1)
+			for _, c := range cases {
+				if f, err := strconv.ParseFloat(fmt.Sprint(c.val), 64); err == nil && f > maxEnum {
+					maxEnum = f
+				}
+			}
+			add(num(maxEnum+1), "not in enum")
+		}
+	}
+	if pm.Pattern != "" {
+		add("", "empty")
+	}
+	return cases
+}
+
+// baseValue 生成边界测试时参数的基准取值：默认值，没有默认值时为第一个满足约束的边界取值，否则为零值
+func baseValue(pm convention.ParaMeta, cases []boundaryCase) any {
+	if pm.Default != nil {
+		if v, err := pm.ParseValue(*pm.Default); err == nil {
+			return v
+		}
+	}
+	for _, c := range cases {
+		if pm.Validate(c.val) == nil {
+			return c.val
+		}
+	}
+	v, err := pm.ParseValue("")
+	if err != nil {
+		v, _ = pm.ParseValue("0")
+	}
+	return v
+}
+
+// genTestsBoundary 根据插件参数的注解生成边界测试用例，预留参数使用默认值，start为第一个测试用例的编号
+func genTestsBoundary(inf *convention.PluginInfo, start int) ([]*Test, error) {
+	contextArgs := convention.GetContextArgs(inf.Type)
+	base := make([]any, len(inf.Params))
+	cases := make([][]boundaryCase, len(inf.Params))
+	annotated := false
+	for i, pm := range inf.Params {
+		if i < len(contextArgs) {
+			base[i] = contextArgs[i]
+			continue
+		}
+		if pm.Annotated() {
+			annotated = true
+			cases[i] = boundaryValues(pm)
+		}
+		base[i] = baseValue(pm, cases[i])
+	}
+	if !annotated {
+		return nil, errors.New("no parameter of the plugin has annotations(DEFAULT, MIN, MAX, ENUM, PATTERN)")
+	}
+	tests := make([]*Test, 0)
+	addTest := func(args []any, desc string) {
+		t := &Test{Args: args}
+		fmt.Printf("test#%d: [args:[", start+len(tests))
+		for j, arg := range args {
+			if j < len(contextArgs) {
+				fmt.Printf("%T", arg)
+			} else {
+				fmt.Print(any2Str(arg))
+			}
+			if j < len(args)-1 {
+				fmt.Print(", ")
+			}
+		}
+		fmt.Printf("]] %s\n", desc)
+		common.FailExit(tryMarshal(t))
+		tests = append(tests, t)
+	}
+	addTest(base, "defaults")
+	for i, pCases := range cases {
+		pm := inf.Params[i]
+		for _, c := range pCases {
+			if fmt.Sprint(c.val) == fmt.Sprint(base[i]) {
+				continue
+			}
+			args := append([]any{}, base...)
+			args[i] = c.val
+			desc := fmt.Sprintf("%s: %s", pm.Param.Name, c.desc)
+			if err := pm.Validate(c.val); err != nil {
+				desc += fmt.Sprintf(" (violates the annotations: %v)", err)
+			}
+			addTest(args, desc)
+		}
+	}
+	return tests, nil
+}
+
 // genStructJsonFile 将一种类型的结构转化为json文件，若数量为1则转化单个json对象，否则转化为切片
 func genStructJsonFile(struType string, to string, num int) {
 	if num <= 0 {
@@ -303,14 +436,24 @@ func runCmdGen(cmd *cobra.Command, _ []string) {
 			common.FailExit("missing plugin file path")
 		}
 		// 获取插件元信息
-		inf, err := common.GetPluginInfo(path)
+		source, _ := cmd.Flags().GetString("source")
+		inf, err := common.LoadPluginInfo(path, true, source, "")
 		common.FailExit(err)
 		fd := convention.BuildFd(inf)
-		var tests []*Test
-		// 根据插件参数生成测试数据
+		tests := make([]*Test, 0)
+		// 根据插件参数生成测试数据，只指定-b时不读取数据源文件
 		files, _ := cmd.Flags().GetString("files")
-		tests, err = genTestsFiles(fd, files)
-		common.FailExit(err)
+		boundary, _ := cmd.Flags().GetBool("boundary")
+		if files != "" || !boundary {
+			tests, err = genTestsFiles(fd, files)
+			common.FailExit(err)
+		}
+		// 根据参数注解生成边界测试用例
+		if boundary {
+			bTests, err := genTestsBoundary(inf, len(tests))
+			common.FailExit(err)
+			tests = append(tests, bTests...)
+		}
 		// 写入文件
 		b, _ := json.MarshalIndent(tests, "", "  ")
 		tryWrite(b, out)
@@ -2,6 +2,7 @@ package test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/nostalgist134/FuzzGIU/components/fuzzTypes"
 	FGPlugin "github.com/nostalgist134/FuzzGIU/components/plugin"
@@ -12,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 )
 
@@ -19,8 +21,10 @@ var subCmdRun = &cobra.Command{
 	Use:   "run",
 	Short: "run test",
 	Long: `run a test over a plugin
-	since this command need to call plugin by arguments and its type, only plugins
-	built with info(build -i) can be tested. there are 2 ways to test a plugin,
+	since this command need to call plugin by arguments and its type, plugins built
+	without info(build -i) need --source to provide them. plugins whose //fgpk:requires
+	excludes the FuzzGIU version fgpk targets are refused unless --ignore-requires is
+	specified. there are 2 ways to test a plugin,
 	expr(-e) and file(-f). 
 	
 	expr mode use the pseudo function call expression the same as fuzzGIU do to call a
@@ -28,10 +32,17 @@ var subCmdRun = &cobra.Command{
 	passed to fgpk by -p flag and it will use it). in this way, some types of plugin
 	has struct argument will use empty structs. also you can't specify expect values
 	for each test. however you can still specify multiple tests by one -e, each 
-	seperated with comma.
+	seperated with comma. arguments are checked against the annotations of the plugin's
+	parameters(MIN, MAX, ENUM, PATTERN) before the plugin is called, calls violating them
+	are skipped.
 
 	file mode use the test files generated by test gen command, for more information,
-	run test gen -h.`,
+	run test gen -h.
+
+	plugins built with build --abi cgo on linux/macOS are tested with --abi cgo, they are
+	loaded through dlopen and their PluginWrapper is called directly, in the way FuzzGIU
+	calls plugins on windows. arguments must have the exact types of the plugin's
+	parameters in this mode.`,
 	Run: runCmdRun,
 }
 
@@ -42,10 +53,31 @@ func init() {
 	subCmdRun.Flags().StringP("file", "f", "",
 		"run test via test files(generated by gen command)")
 	subCmdRun.Flags().StringP("out", "o", "", "output test result to a json file")
+	subCmdRun.Flags().String("source", "", "plugin source file or directory, used to get the parameter "+
+		"list when the plugin has no PluginInfo")
+	subCmdRun.Flags().Bool("ignore-requires", false, "test the plugin even if its required FuzzGIU "+
+		"version excludes the one fgpk targets")
+	subCmdRun.Flags().String("abi", "", "ABI the plugin is built with, cgo or plugin "+
+		"(default: cgo on windows, plugin otherwise)")
 }
 
 var testRecord = make([]ResultTest, 0)
 var writeResultToFile = false
+var ignoreRequires = false
+var testABI = ""
+
+// loadPluginInfo 获取被测插件的元信息，并检查插件要求的FuzzGIU版本
+func loadPluginInfo(pluginPath string, source string) *convention.PluginInfo {
+	inf, err := common.LoadPluginInfo(pluginPath, true, source, testABI)
+	common.FailExit(err)
+	if err = common.CheckRequires(inf); err != nil {
+		if !ignoreRequires {
+			common.FailExit(fmt.Sprintf("%v, use --ignore-requires to test it anyway", err))
+		}
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	return inf
+}
 
 func recordTest(t any, result any, passed bool) {
 	if !writeResultToFile {
@@ -55,7 +87,7 @@ func recordTest(t any, result any, passed bool) {
 		testRecord = append(testRecord, ResultTest{
 			T:      Test{Args: p.Args},
 			Result: result,
-			Passed: true,
+			Passed: passed,
 		})
 	} else if test, ok := t.(Test); ok {
 		testRecord = append(testRecord, ResultTest{
@@ -136,21 +168,29 @@ func callPluginByType(pType string, p fuzzTypes.Plugin, contextArgs ...any) any
 	return nil
 }
 
-// cmpParaTypes 判断参数列表的类型是否完全对应，是返回true，否则返回false
-func cmpParaTypes(p1 []any, p2 []convention.Param) bool {
-	if len(p1) != len(p2) {
-		return false
+// reportCoercion 输出需要由PluginWrapper转换类型的参数
+func reportCoercion(mismatched []int, args []any, params []convention.Param) {
+	for _, i := range mismatched {
+		fmt.Printf("argument#%d %T(%v) will be converted to %s %s by the plugin wrapper\n", i, args[i], args[i],
+			params[i].Name, params[i].Type)
 	}
-	for i, p := range p1 {
-		if reflect.TypeOf(p).String() != p2[i].Type {
-			return false
+}
+
+// validateArgs 按参数注解（MIN、MAX、ENUM、PATTERN）检查实参，返回第一个不满足约束的实参的错误
+func validateArgs(args []any, params []convention.ParaMeta) error {
+	for i, a := range args {
+		if i >= len(params) {
+			break
+		}
+		if err := params[i].Validate(a); err != nil {
+			return fmt.Errorf("argument#%d %s: %v", i, params[i].Param.Name, err)
 		}
 	}
-	return true
+	return nil
 }
 
 // callPluginExpr 使用伪函数调用语句调用插件（plugin1("1",2,3),plugin1("abc"),...），无法指定固定参数或期望值，只能使用默认值
-func callPluginExpr(callExpr string, pluginPath string) {
+func callPluginExpr(callExpr string, pluginPath string, source string) {
 	// FGPlugin包不会检查路径，所以可以用路径穿越绕过加载目录限制，我也懒得再把包重构一遍了，就这么着吧
 	// 获取插件文件相关信息，存储穿越前的路径和穿越后的路径
 	pName := filepath.Base(pluginPath)
@@ -158,6 +198,8 @@ func callPluginExpr(callExpr string, pluginPath string) {
 	pName1 := filepath.Join("../../", pName)
 
 	var err error
+	absPath, err := filepath.Abs(pluginPath)
+	common.FailExit(err)
 
 	// 切换到插件所在目录
 	cwd := env.GetCwd()
@@ -168,8 +210,7 @@ func callPluginExpr(callExpr string, pluginPath string) {
 	plugins, err := FGPlugin.ParsePluginsStr(callExpr)
 	common.FailExit(err)
 
-	inf, err := common.GetPluginInfo(pluginPath)
-	common.FailExit(err)
+	inf := loadPluginInfo(pluginPath, source)
 
 	fd := convention.BuildFd(inf)
 	contextArgs := convention.GetContextArgs(inf.Type)
@@ -185,33 +226,67 @@ func callPluginExpr(callExpr string, pluginPath string) {
 
 		// 穿越前的路径用于输出
 		p.Name = pName
-		if !cmpParaTypes(argListCmp, fd.Params) {
+		mismatched, ok := argsMismatch(argListCmp, fd.Params, len(contextArgs))
+		if !ok {
 			recordTest(p, nil, false)
 			fmt.Fprintf(os.Stderr, "arglist#%d arguments does not match plugin's, skipping\n", i)
 			continue
 		}
+		if err := validateArgs(argListCmp, inf.Params); err != nil {
+			recordTest(p, err.Error(), false)
+			fmt.Fprintf(os.Stderr, "arglist#%d %v, skipping\n", i, err)
+			continue
+		}
 		fmt.Printf("test on: %v\n", p)
 
+		// 自定义参数类型不同时由PluginWrapper转换，直接调用PluginWrapper以检查转换结果
+		if callDirectly(mismatched, inf) {
+			if len(mismatched) > 0 && testABI != convention.ABICgo {
+				reportCoercion(mismatched, argListCmp, fd.Params)
+			}
+			result, err := callWrapper(absPath, inf.Type, fd, contextArgs, p.Args, mismatched)
+			// 实参转换失败时包装代码不会调用Init，这样的调用不计入自定义实参的组数
+			if reachedInit(err) {
+				hooks.record(inf.Type, argListCmp, len(mismatched) > 0)
+			}
+			if errors.Is(err, errors.ErrUnsupported) {
+				recordTest(p, nil, false)
+				fmt.Fprintf(os.Stderr, "arglist#%d arguments can't be converted by this plugin, skipping\n", i)
+				continue
+			} else if err != nil {
+				recordTest(p, err.Error(), false)
+				fmt.Printf("error: %v\n", err)
+				continue
+			}
+			recordTest(p, result, true)
+			fmt.Printf("result: %v\n", result)
+			continue
+		}
+
 		// 穿越后的路径用于调用
 		p.Name = pName1
 		result := callPluginByType(inf.Type, p)
+		hooks.record(inf.Type, argListCmp, len(mismatched) > 0)
 
 		// 输出到文件
 		p.Name = pName
 		recordTest(p, result, true)
 		fmt.Printf("result: %v\n", result)
 	}
+	verifyHooks(absPath, inf)
 }
 
 // callPluginTestFile 从文件中读取测试用例并执行
-func callPluginTestFile(filePath string, pluginPath string) {
+func callPluginTestFile(filePath string, pluginPath string, source string) {
 	pName := filepath.Base(pluginPath)
 	pName = pName[:strings.LastIndex(pName, ".")]
 	pName = filepath.Join("../../", pName)
 
-	// 获取插件信息
-	inf, err := common.GetPluginInfo(pluginPath)
+	absPath, err := filepath.Abs(pluginPath)
 	common.FailExit(err)
+
+	// 获取插件信息
+	inf := loadPluginInfo(pluginPath, source)
 	fd := convention.BuildFd(inf)
 
 	contextArgs := convention.GetContextArgs(inf.Type)
@@ -265,7 +340,8 @@ func callPluginTestFile(filePath string, pluginPath string) {
 			}
 		}
 
-		if !cmpParaTypes(test.Args, fd.Params) {
+		mismatched, ok := argsMismatch(test.Args, fd.Params, ctxArgNum)
+		if !ok {
 			fmt.Fprintf(os.Stderr, "test#%d arguments does not match plugin's, skip\n", i)
 			continue
 		}
@@ -294,8 +370,35 @@ func callPluginTestFile(filePath string, pluginPath string) {
 		}
 
 		fmt.Println("test on: ", test)
-		result := callPluginByType(inf.Type, p, contextArgs...)
+		var result any
+		if callDirectly(mismatched, inf) || test.ExpectErr != nil {
+			// 自定义参数类型不同时由PluginWrapper转换，转换失败、Init以及插件函数返回的错误在未期望错误时视为测试失败
+			if len(mismatched) > 0 && testABI != convention.ABICgo {
+				reportCoercion(mismatched, test.Args, fd.Params)
+			}
+			result, err = callWrapper(absPath, inf.Type, fd, contextArgs, p.Args, mismatched)
+			if reachedInit(err) {
+				hooks.record(inf.Type, test.Args, len(mismatched) > 0)
+			}
+			if errors.Is(err, errors.ErrUnsupported) {
+				fmt.Fprintf(os.Stderr, "test#%d arguments can't be converted by this plugin, skip\n", i)
+				continue
+			} else if err != nil {
+				fmt.Println("error: ", err)
+				recordTest(test, err.Error(), checkExpectedErr(test.ExpectErr, err))
+				continue
+			}
+		} else {
+			result = callPluginByType(inf.Type, p, contextArgs...)
+			hooks.record(inf.Type, test.Args, len(mismatched) > 0)
+		}
 		fmt.Println("result: ", result)
+		if test.ExpectErr != nil {
+			fmt.Printf("expect error: %q\n", *test.ExpectErr)
+			fmt.Println("failed")
+			recordTest(test, result, false)
+			continue
+		}
 
 		// 比较返回值与期望值
 		passed := true
@@ -311,6 +414,44 @@ func callPluginTestFile(filePath string, pluginPath string) {
 
 		recordTest(test, result, passed)
 	}
+	verifyHooks(absPath, inf)
+}
+
+// checkExpectedErr 检查插件调用返回的错误是否符合期望并输出结果：未期望错误时测试失败；期望的错误信息为空时
+// 任何错误都符合，否则错误信息须包含期望的内容。cgo方式下导出函数只返回错误信号，没有错误信息，只能检查是否出错
+func checkExpectedErr(expectErr *string, err error) bool {
+	if expectErr == nil {
+		fmt.Println("failed")
+		return false
+	}
+	fmt.Printf("expect error: %q\n", *expectErr)
+	switch {
+	case *expectErr == "" || strings.Contains(err.Error(), *expectErr):
+	case testABI == convention.ABICgo:
+		fmt.Println("the cgo ABI returns no error message, only the presence of the error is checked")
+	default:
+		fmt.Println("failed")
+		return false
+	}
+	fmt.Println("passed")
+	return true
+}
+
+// setTestABI 设置被测插件的调用方式，非windows系统上的cgo方式插件（build --abi cgo）通过dlopen调用
+func setTestABI(cmd *cobra.Command) {
+	testABI, _ = cmd.Flags().GetString("abi")
+	switch testABI {
+	case "":
+		testABI = convention.ABIOf(runtime.GOOS)
+	case convention.ABICgo, convention.ABIPlugin:
+	default:
+		common.FailExit(fmt.Sprintf("unknown ABI %s, expect %s or %s", testABI, convention.ABICgo,
+			convention.ABIPlugin))
+	}
+	if testABI == convention.ABIPlugin && runtime.GOOS == "windows" {
+		common.FailExit("go plugins are not supported on windows")
+	}
+	cgoDlopen = testABI == convention.ABICgo && runtime.GOOS != "windows"
 }
 
 func runCmdRun(cmd *cobra.Command, _ []string) {
@@ -322,13 +463,22 @@ func runCmdRun(cmd *cobra.Command, _ []string) {
 		writeResultToFile = true
 		defer writeTestTo(outFile)
 	}
+	if path == "" {
+		common.FailExit("missing plugin path(-p)")
+	}
+	source, _ := cmd.Flags().GetString("source")
+	ignoreRequires, _ = cmd.Flags().GetBool("ignore-requires")
+	setTestABI(cmd)
+	if !cgoDlopen {
+		common.FailExit(common.PreCheckPlugin(path))
+	}
 	if expr != "" {
-		callPluginExpr(expr, path)
+		callPluginExpr(expr, path, source)
 	} else {
 		file, _ := cmd.Flags().GetString("file")
 		if file == "" {
 			common.FailExit("missing test data(-f or -e)")
 		}
-		callPluginTestFile(file, path)
+		callPluginTestFile(file, path, source)
 	}
 }
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"errors"
+	"github.com/nostalgist134/FuzzGIUPluginKit/cmd/common"
+	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
+	"reflect"
+	"strings"
+)
+
+// argsMismatch 比较实参与插件的参数列表，返回类型不同的自定义参数的下标；
+// 参数个数不同或预留参数的类型不同时ok为false
+func argsMismatch(args []any, params []convention.Param, ctxArgNum int) (mismatched []int, ok bool) {
+	if len(args) != len(params) {
+		return nil, false
+	}
+	for i, a := range args {
+		if a != nil && reflect.TypeOf(a).String() == params[i].Type {
+			continue
+		}
+		if i < ctxArgNum {
+			return nil, false
+		}
+		mismatched = append(mismatched, i)
+	}
+	return mismatched, true
+}
+
+// argError 调用插件函数之前组装或转换实参时发生的错误，此时包装代码还没有调用插件的Init
+type argError struct {
+	error
+}
+
+func (e argError) Unwrap() error {
+	return e.error
+}
+
+// argErrorPrefix PluginWrapper转换自定义参数失败时返回的错误的前缀，见tmpl/templates/plugin/ArgCoerce.gotmp
+const argErrorPrefix = "custom argument "
+
+// reachedInit 调用PluginWrapper返回err时，包装代码是否已经执行到Init（实参转换成功）
+func reachedInit(err error) bool {
+	var ae argError
+	return err == nil || !(errors.Is(err, errors.ErrUnsupported) || errors.As(err, &ae))
+}
+
+// callWrapperCoerced 实参类型与插件的参数类型不同时，由PluginWrapper负责转换，
+// 直接调用PluginWrapper才能得到转换失败时返回的错误
+func callWrapperCoerced(pluginPath string, pType string, fd convention.FuncDecl, contextArgs []any,
+	args []any) (any, error) {
+	wArgs, err := common.PluginWrapperArgs(pType, append(append([]any{}, contextArgs...), args...))
+	if err != nil {
+		return nil, argError{err}
+	}
+	b, err := common.CallPluginWrapper(pluginPath, wArgs...)
+	if err != nil && strings.HasPrefix(err.Error(), argErrorPrefix) {
+		return nil, argError{err}
+	} else if err != nil {
+		return nil, err
+	}
+	return common.DecodeWrapperResult(fd.RetType, b)
+}
+
+// cgoDlopen 在非windows系统上测试cgo方式编译的插件时为true。FuzzGIU的插件加载器在这些系统上只能加载go插件，
+// 因此所有调用都通过dlopen直接调用PluginWrapper
+var cgoDlopen = false
+
+// callWrapper 直接调用插件的PluginWrapper，mismatched为实参类型与插件参数类型不同的自定义参数
+func callWrapper(pluginPath string, pType string, fd convention.FuncDecl, contextArgs []any, args []any,
+	mismatched []int) (any, error) {
+	if testABI != convention.ABICgo {
+		return callWrapperCoerced(pluginPath, pType, fd, contextArgs, args)
+	}
+	// cgo方式的包装函数按参数类型解释传入的机器字，无法转换类型
+	if len(mismatched) > 0 {
+		return nil, errors.ErrUnsupported
+	}
+	b, err := common.CallCgoWrapper(pluginPath, pType, append(append([]any{}, contextArgs...), args...))
+	if err != nil {
+		return nil, err
+	}
+	return common.DecodeWrapperResult(fd.RetType, b)
+}
+
+// callDirectly 是否绕过FuzzGIU的插件加载器直接调用PluginWrapper：FuzzGIU不会返回PluginWrapper的错误，
+// 实参需要转换类型、插件定义了生命周期函数或插件函数返回(T, error)时，直接调用才能得到转换失败、Init或插件函数
+// 返回的错误；非windows系统上的cgo方式插件则只能直接调用
+func callDirectly(mismatched []int, inf *convention.PluginInfo) bool {
+	return len(mismatched) > 0 || cgoDlopen || len(inf.Hooks) > 0 || inf.ReturnsError
+}
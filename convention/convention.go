@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/nostalgist134/FuzzGIU/components/fuzzTypes"
-	"github.com/nostalgist134/FuzzGIUPluginKit/env"
 	"github.com/nostalgist134/FuzzGIUPluginKit/tmpl"
 	"os"
 	"strconv"
@@ -31,6 +30,14 @@ func GetPluginType(pluginFunName string) string {
 	return ""
 }
 
+// ABIOf 返回插件在目标系统上的默认调用方式
+func ABIOf(goos string) string {
+	if goos == "windows" {
+		return ABICgo
+	}
+	return ABIPlugin
+}
+
 func GetFuncDecl(pluginType string) FuncDecl {
 	for t, fd := range FuncDecls {
 		if strings.ToLower(t) == strings.ToLower(pluginType) {
@@ -40,39 +47,22 @@ func GetFuncDecl(pluginType string) FuncDecl {
 	return FuncDecl{}
 }
 
-func compareFuncDecl(fd FuncDecl, correctFd FuncDecl) (equal bool, reason string) {
-	if len(fd.Params) < len(correctFd.Params) {
-		equal = false
-		reason = fmt.Sprintf("argument count not enough, at least %d arguments needed", len(correctFd.Params))
-		return
-	}
-	for i, p := range correctFd.Params {
-		if p.Name != fd.Params[i].Name || p.Type != fd.Params[i].Type {
-			equal, reason = false, fmt.Sprintf(`param %d incorrect, given: "%s %s", wanted: "%s %s"`,
-				i, fd.Params[i].Name, fd.Params[i].Type, p.Name, p.Type)
-			return
-		}
-	}
-	if fd.RetType != correctFd.RetType {
-		equal, reason = false, fmt.Sprintf(`return type incorrect, given: "%s", wanted: "%s"`, fd.RetType,
-			correctFd.RetType)
-	}
-	equal = true
-	return
-}
+// errRetSuffix 插件函数返回(T, error)时返回类型字符串的后缀
+const errRetSuffix = ", error"
 
-// CheckPluginFun 判断插件函数的函数声明是否符合规范
-func CheckPluginFun(pluginType string, fd FuncDecl) (bool, string) {
-	correctFd := GetFuncDecl(pluginType)
-	return compareFuncDecl(fd, correctFd)
+// ReturnsError 判断插件函数是否以(T, error)的形式返回，T为约定的返回类型
+func ReturnsError(pluginType string, fd FuncDecl) bool {
+	return fd.RetType == GetFuncDecl(pluginType).RetType+errRetSuffix
 }
 
-func CheckPluginMinorFunc(pType string, fd FuncDecl) (bool, string) {
-	if pType != PluginTypes[IndPTypeIterator] {
-		return true, ""
+// PluginFunDecl 返回插件函数fd应当遵循的函数原型。插件函数可以返回约定的类型T，也可以返回(T, error)，
+// fd的返回值以error结尾时，约定的返回类型同样带有error
+func PluginFunDecl(pluginType string, fd FuncDecl) FuncDecl {
+	correctFd := GetFuncDecl(pluginType)
+	if strings.HasSuffix(fd.RetType, errRetSuffix) {
+		correctFd.RetType += errRetSuffix
 	}
-	correctFd := FuncDecls[PluginMinorFun[IndPTypeIteratorMinor]]
-	return compareFuncDecl(fd, correctFd)
+	return correctFd
 }
 
 // genPluginFun 根据插件类型生成对应的插件函数
@@ -108,62 +98,58 @@ func genPluginFun(pluginType string) string {
 	return fn
 }
 
-// GenPlugInfoFun 生成PluginInfo函数
-func GenPlugInfoFun(pName, pType, goVer, usageFile string, params []ParaMeta) string {
-	var usage string
+// GenPlugInfoFun 生成abi调用方式下的PluginInfo函数，usageFile的内容会作为插件的用法信息
+func GenPlugInfoFun(abi string, pi PluginInfo, usageFile string) string {
 	if usageFile != "" {
 		b, err := os.ReadFile(usageFile)
 		if err != nil {
 			fmt.Printf("read usage file failed - %v, set empty\n", err)
 		} else {
-			usage = string(b)
+			pi.UsageInfo = string(b)
 		}
 	}
-	pi := PluginInfo{
-		Name:      pName,
-		Type:      pType,
-		GoVersion: goVer,
-		UsageInfo: usage,
-		Params:    params,
-	}
 	j, _ := json.Marshal(pi)
-	quoted := strconv.Quote(string(j))
-	pFun, err := tmpl.GetTemplate(env.GlobEnv.OS, "pluginInfo")
+	quoted := strconv.Quote(PlugInfoBegin + string(j) + PlugInfoEnd)
+	pFun, err := tmpl.RenderPluginInfo(abi, tmpl.PluginInfo{Raw: quoted, BeginLen: len(PlugInfoBegin),
+		EndLen: len(PlugInfoEnd)})
 	if err != nil {
 		fmt.Printf("warning: gen PluginInfo failed: %v\n", err)
 	}
-	pFun = tmpl.Replace(pFun, tmpl.PHPlugInfo, quoted)
 	return pFun
 }
 
-// GetParamStrings 获取用于替换go模板文件中的参数占位符的字符串
-func GetParamStrings(os, pluginType string, params []Param) (formal string, actual string) {
+// ArgCoerceFun 返回plugin方式下将自定义参数转换为类型t的函数名（定义在ArgCoerce模板中）
+func ArgCoerceFun(t string) string {
+	return "fgpkArg" + strings.ToUpper(t[:1]) + t[1:]
+}
+
+// GetCustomParams 返回渲染包装代码模板所需的自定义参数（插件函数在约定参数之后的参数）
+func GetCustomParams(pluginType string, params []Param) []tmpl.CustomParam {
 	correctFd := GetFuncDecl(pluginType)
-	if len(correctFd.Params) > len(params) {
-		return
+	custom := make([]tmpl.CustomParam, 0)
+	/*
+		1.由于plugin库的特性，调用函数前必须断言为一个固定的函数类型，但是要支持用户自定义参数，因此PluginWrapper的形参只能写成...any
+		2.写好的插件函数其中的参数类型就已经固定下来了，但是PluginWrapper的参数列表是any类型，因此用户自定义实参需要按顺序转换，
+		  FuzzGIU传入的参数类型不一定与插件函数的参数类型相同（如0x10会被解析为int64），直接断言会导致宿主程序panic，
+		  因此使用ArgCoerce模板中的函数转换，无法转换时PluginWrapper返回错误
+		cgo方式下自定义参数直接作为导出函数的参数，Coerce与ArgIndex不会被用到
+	*/
+	// iterator插件的参数列表中，lengths之后还有一个选择调用IterIndex或IterLen的参数
+	offset := 0
+	if pluginType == PluginTypes[IndPTypeIterator] {
+		offset = 1
 	}
-	formalParams := strings.Builder{}
-	actualParams := strings.Builder{}
-	// 非windows（使用plugin库）
-	if os != "windows" {
-		/*
-			1.由于plugin库的特性，调用函数前必须断言为一个固定的函数类型，但是要支持用户自定义参数，因此形参只能写成...any
-			2.写好的插件函数其中的参数类型就已经固定下来了，但是PluginWrapper的参数列表是any类型，因此用户自定义实参列表需要按顺序类型断言
-		*/
-		formalParams.WriteString("args ...any")
-		//从固定参数之后开始动态补全用户自定义参数（下标也必须对应）
-		for i := len(correctFd.Params); i < len(params); i++ {
-			actualParams.WriteString(fmt.Sprintf("args[%d].(%s),", i, params[i].Type))
-		}
-	} else {
-		for i := len(correctFd.Params); i < len(params); i++ {
-			formalParams.WriteString(fmt.Sprintf("%s %s,", params[i].Name, params[i].Type))
-			actualParams.WriteString(params[i].Name + ",")
-		}
+	//从固定参数之后开始动态补全用户自定义参数（下标也必须对应）
+	for i := len(correctFd.Params); i < len(params); i++ {
+		custom = append(custom, tmpl.CustomParam{
+			Name:     params[i].Name,
+			Type:     params[i].Type,
+			Index:    i,
+			ArgIndex: i + offset,
+			Coerce:   ArgCoerceFun(params[i].Type),
+		})
 	}
-	formal = formalParams.String()
-	actual = actualParams.String()
-	return
+	return custom
 }
 
 // GetContextArgs 根据插件类型返回预留参数
@@ -215,15 +201,26 @@ func GenCodePType(pluginType string) string {
 	return fmt.Sprintf("package main\n%s\n%s\n", imp, fn)
 }
 
-// DefMinorFun 次要函数，目前只有iterator插件的IterLen使用这个函数生成
-func DefMinorFun(pluginType string) string {
-	if pluginType != PluginTypes[IndPTypeIterator] {
+// DefMinorFun 生成插件省略的次要函数：iterator插件的IterLen返回-1，生命周期函数Init与Close什么也不做。
+// IterLen与Init的参数列表与插件函数的自定义参数一致
+func DefMinorFun(minorFun string, custom []tmpl.CustomParam) string {
+	paraList := make([]string, 0, len(custom)+1)
+	var body string
+	switch minorFun {
+	case PluginMinorFun[IndPTypeIteratorMinor]:
+		paraList = append(paraList, "lengths []int")
+		body = "int {\n\treturn -1\n}"
+	case PluginMinorFun[IndInitMinor]:
+		body = "error {\n\treturn nil\n}"
+	case PluginMinorFun[IndCloseMinor]:
+		return "func Close() {}\n"
+	default:
 		return ""
 	}
-	return `func IterLen(lengths []int, /* FORMAL PARAMETERS */) int {
-	return -1
-}
-`
+	for _, p := range custom {
+		paraList = append(paraList, fmt.Sprintf("%s %s", p.Name, p.Type))
+	}
+	return fmt.Sprintf("func %s(%s) %s\n", minorFun, strings.Join(paraList, ", "), body)
 }
 
 func GetStruct(structType string) any {
@@ -14,11 +14,34 @@ const (
 	IndPTypePreproc
 	IndPTypeIterator
 	IndPTypeIteratorMinor = 0
+	IndInitMinor          = 1
+	IndCloseMinor         = 2
+)
+
+// PlugInfoBegin 与 PlugInfoEnd 是插件元信息在二进制文件中的前后标记，用于不加载插件直接读取元信息
+const (
+	PlugInfoBegin = "\x00FGPK_PLUGIN_INFO_BEGIN\x00"
+	PlugInfoEnd   = "\x00FGPK_PLUGIN_INFO_END\x00"
 )
 
 var PluginFunNames = []string{"PayloadProcessor", "React", "PayloadGenerator", "DoRequest", "Preprocess", "IterIndex"}
 var PluginTypes = []string{"payloadProc", "reactor", "payloadGen", "requester", "preprocess", "iterator"}
-var PluginMinorFun = []string{"IterLen"}
+
+// PluginMinorFun 次要插件函数：iterator插件的IterLen，以及所有插件类型都可以定义的生命周期函数Init与Close
+var PluginMinorFun = []string{"IterLen", "Init", "Close"}
+
+// 插件的调用方式（ABI），决定自定义参数如何从FuzzGIU传递到插件函数
+const (
+	ABIPlugin = "plugin" // 编译为go plugin，通过plugin库加载，参数以any传递（linux/macOS）
+	ABICgo    = "cgo"    // 编译为c-shared动态库，参数以uintptr传递给导出的C函数（windows）
+)
+
+// CustomParamTypes 各ABI下用户自定义参数支持的类型，即FuzzGIU的插件调用表达式能够产生、且能够正确传递的类型。
+// cgo方式下每个参数都放在整数寄存器中传递，浮点数参数会被插件从浮点寄存器读取，因此不支持float64
+var CustomParamTypes = map[string][]string{
+	ABIPlugin: {"int", "float64", "string", "bool"},
+	ABICgo:    {"int", "string", "bool"},
+}
 
 // FuncDecls 每种插件的约定函数原型
 var FuncDecls = map[string]FuncDecl{
@@ -46,10 +69,20 @@ var FuncDecls = map[string]FuncDecl{
 		Params:  []Param{{Name: "lengths", Type: "[]int"}, {"ind", "int"}},
 		RetType: "[]int",
 	},
+	// IterLen在lengths之后还有与插件函数相同的自定义参数，见MinorFunDecl
 	PluginMinorFun[IndPTypeIteratorMinor]: {
 		Params:  []Param{{Name: "lengths", Type: "[]int"}},
 		RetType: "int",
 	},
+	// Init的参数与插件函数的自定义参数相同，见MinorFunDecl
+	PluginMinorFun[IndInitMinor]: {
+		Params:  []Param{},
+		RetType: "error",
+	},
+	PluginMinorFun[IndCloseMinor]: {
+		Params:  []Param{},
+		RetType: "",
+	},
 }
 
 var fullReq = &fuzzTypes.Req{
@@ -0,0 +1,307 @@
+package convention
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 参数注解，写在自定义参数的参数名与类型之间的注释中，例如：
+//
+//	n /*INFO: 重复次数*/ /*DEFAULT: 1*/ /*MIN: 1*/ /*MAX: 16*/ int
+const (
+	AnnotInfo    = "INFO"    // 参数说明
+	AnnotDefault = "DEFAULT" // 默认值
+	AnnotMin     = "MIN"     // 最小值（int、float64）
+	AnnotMax     = "MAX"     // 最大值（int、float64）
+	AnnotEnum    = "ENUM"    // 允许的取值，以逗号分隔，含有逗号的取值用Go字符串字面量表示（int、float64、string）
+	AnnotPattern = "PATTERN" // 取值需要匹配的正则表达式（string）
+)
+
+// ParamAnnotations 支持的参数注解
+var ParamAnnotations = []string{AnnotInfo, AnnotDefault, AnnotMin, AnnotMax, AnnotEnum, AnnotPattern}
+
+// SetAnnotation 按注解设置参数元信息中对应的字段，注解的值是否与参数类型相符由CheckAnnotations检查
+func (pm *ParaMeta) SetAnnotation(key, val string) error {
+	dup := false
+	switch key {
+	case AnnotInfo:
+		dup = pm.ParaInfo != ""
+		pm.ParaInfo = val
+	case AnnotDefault:
+		dup = pm.Default != nil
+		pm.Default = &val
+	case AnnotMin, AnnotMax:
+		f, err := parseNumber(val)
+		if err != nil {
+			return fmt.Errorf("%s %q is not a number", key, val)
+		}
+		if key == AnnotMin {
+			dup = pm.Min != nil
+			pm.Min = &f
+		} else {
+			dup = pm.Max != nil
+			pm.Max = &f
+		}
+	case AnnotEnum:
+		dup = pm.Enum != nil
+		enum, err := splitEnum(val)
+		if err != nil {
+			return fmt.Errorf("ENUM %v", err)
+		}
+		pm.Enum = enum
+	case AnnotPattern:
+		dup = pm.Pattern != ""
+		pm.Pattern = val
+	default:
+		return fmt.Errorf("unknown annotation %s (supported: %s)", key, strings.Join(ParamAnnotations, ", "))
+	}
+	if dup {
+		return fmt.Errorf("duplicate annotation %s", key)
+	}
+	return nil
+}
+
+// splitEnum 以逗号分隔ENUM的取值，以双引号或反引号括起的取值按Go字符串字面量解析，其中可以含有逗号
+func splitEnum(val string) ([]string, error) {
+	enum := make([]string, 0)
+	start, quote := 0, rune(0)
+	for i := 0; i <= len(val); i++ {
+		if i < len(val) {
+			c := rune(val[i])
+			switch {
+			case quote == '"' && c == '\\':
+				if i+1 < len(val) {
+					i++
+				}
+				continue
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+				continue
+			case (c == '"' || c == '`') && strings.TrimSpace(val[start:i]) == "":
+				quote = c
+				continue
+			case c != ',':
+				continue
+			}
+		} else if quote != 0 {
+			return nil, fmt.Errorf("value %s has an unterminated quote", strings.TrimSpace(val[start:]))
+		}
+		item := strings.TrimSpace(val[start:i])
+		if strings.HasPrefix(item, "\"") || strings.HasPrefix(item, "`") {
+			v, err := strconv.Unquote(item)
+			if err != nil {
+				return nil, fmt.Errorf("value %s is not a valid quoted string", item)
+			}
+			item = v
+		}
+		enum = append(enum, item)
+		start = i + 1
+	}
+	return enum, nil
+}
+
+// enumString 以"[a, b]"的形式输出允许的取值，string参数的取值带引号
+func (pm ParaMeta) enumString() string {
+	items := make([]string, 0, len(pm.Enum))
+	for _, e := range pm.Enum {
+		if pm.Param.Type == "string" {
+			e = strconv.Quote(e)
+		}
+		items = append(items, e)
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// parseNumber 解析整数（支持0x等前缀）或浮点数
+func parseNumber(s string) (float64, error) {
+	if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return float64(i), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// HasConstraints 参数是否有取值约束（最小值、最大值、允许的取值或正则表达式）
+func (pm ParaMeta) HasConstraints() bool {
+	return pm.Min != nil || pm.Max != nil || pm.Enum != nil || pm.Pattern != ""
+}
+
+// Annotated 参数是否有默认值或取值约束
+func (pm ParaMeta) Annotated() bool {
+	return pm.Default != nil || pm.HasConstraints()
+}
+
+// ParseValue 将注解中的字面量解析为参数类型的值
+func (pm ParaMeta) ParseValue(s string) (any, error) {
+	switch pm.Param.Type {
+	case "int":
+		if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return int(i), nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f != math.Trunc(f) || math.Abs(f) > math.MaxInt64 {
+			return nil, fmt.Errorf("%q is not an integer", s)
+		}
+		return int(f), nil
+	case "float64":
+		f, err := parseNumber(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+		return f, nil
+	case "string":
+		return s, nil
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a bool", s)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("annotations are not supported on parameters of type %s", pm.Param.Type)
+}
+
+// CheckAnnotations 检查注解是否适用于参数的类型，以及默认值与允许的取值是否满足约束
+func (pm ParaMeta) CheckAnnotations() error {
+	if !pm.Annotated() {
+		return nil
+	}
+	t := pm.Param.Type
+	if t != "int" && t != "float64" && t != "string" && t != "bool" {
+		return fmt.Errorf("annotations are not supported on parameters of type %s", t)
+	}
+	numeric := t == "int" || t == "float64"
+	if (pm.Min != nil || pm.Max != nil) && !numeric {
+		return fmt.Errorf("MIN and MAX only apply to int and float64 parameters, not %s", t)
+	}
+	if t == "int" {
+		for _, f := range []*float64{pm.Min, pm.Max} {
+			if f != nil && *f != math.Trunc(*f) {
+				return fmt.Errorf("bound %v of an int parameter is not an integer", *f)
+			}
+		}
+	}
+	if pm.Min != nil && pm.Max != nil && *pm.Min > *pm.Max {
+		return fmt.Errorf("MIN %v is greater than MAX %v", *pm.Min, *pm.Max)
+	}
+	if pm.Pattern != "" {
+		if t != "string" {
+			return fmt.Errorf("PATTERN only applies to string parameters, not %s", t)
+		}
+		if _, err := regexp.Compile(pm.Pattern); err != nil {
+			return fmt.Errorf("PATTERN: %v", err)
+		}
+	}
+	if pm.Enum != nil && t == "bool" {
+		return fmt.Errorf("ENUM doesn't apply to bool parameters")
+	}
+	for _, e := range pm.Enum {
+		v, err := pm.ParseValue(e)
+		if err != nil {
+			return fmt.Errorf("ENUM value %v", err)
+		}
+		if err = pm.checkRange(v); err != nil {
+			return fmt.Errorf("ENUM value %v", err)
+		}
+	}
+	if pm.Default != nil {
+		v, err := pm.ParseValue(*pm.Default)
+		if err != nil {
+			return fmt.Errorf("DEFAULT %v", err)
+		}
+		if err = pm.Validate(v); err != nil {
+			return fmt.Errorf("DEFAULT %v", err)
+		}
+	}
+	return nil
+}
+
+// toParamType 将实参转换为参数类型的值，转换方式与plugin方式下包装代码转换自定义参数的方式相同
+func (pm ParaMeta) toParamType(v any) (any, bool) {
+	if b, ok := v.(bool); ok && pm.Param.Type != "bool" && pm.Param.Type != "string" {
+		if b {
+			v = 1
+		} else {
+			v = 0
+		}
+	}
+	pv, err := pm.ParseValue(fmt.Sprint(v))
+	return pv, err == nil
+}
+
+// checkRange 检查值是否在最小值与最大值之间，以及是否匹配正则表达式
+func (pm ParaMeta) checkRange(v any) error {
+	var f float64
+	switch n := v.(type) {
+	case int:
+		f = float64(n)
+	case float64:
+		f = n
+	case string:
+		if pm.Pattern != "" && !regexp.MustCompile(pm.Pattern).MatchString(n) {
+			return fmt.Errorf("%q doesn't match the pattern %s", n, pm.Pattern)
+		}
+		return nil
+	default:
+		return nil
+	}
+	if pm.Min != nil && f < *pm.Min {
+		return fmt.Errorf("%v is less than the minimum %v", v, *pm.Min)
+	}
+	if pm.Max != nil && f > *pm.Max {
+		return fmt.Errorf("%v is greater than the maximum %v", v, *pm.Max)
+	}
+	return nil
+}
+
+// Validate 检查实参是否满足参数的约束。无法转换为参数类型的实参不在此检查，它们会使包装代码返回转换错误
+func (pm ParaMeta) Validate(v any) error {
+	if !pm.HasConstraints() {
+		return nil
+	}
+	pv, ok := pm.toParamType(v)
+	if !ok {
+		return nil
+	}
+	if err := pm.checkRange(pv); err != nil {
+		return err
+	}
+	if pm.Enum == nil {
+		return nil
+	}
+	for _, e := range pm.Enum {
+		if ev, err := pm.ParseValue(e); err == nil && ev == pv {
+			return nil
+		}
+	}
+	return fmt.Errorf("%#v is not one of %s", pv, pm.enumString())
+}
+
+// AnnotationString 以"default: 1, min: 1, max: 16"的形式输出参数的默认值与约束
+func (pm ParaMeta) AnnotationString() string {
+	parts := make([]string, 0)
+	if pm.Default != nil {
+		if pm.Param.Type == "string" {
+			parts = append(parts, fmt.Sprintf("default: %q", *pm.Default))
+		} else {
+			parts = append(parts, "default: "+*pm.Default)
+		}
+	}
+	if pm.Min != nil {
+		parts = append(parts, fmt.Sprintf("min: %v", *pm.Min))
+	}
+	if pm.Max != nil {
+		parts = append(parts, fmt.Sprintf("max: %v", *pm.Max))
+	}
+	if pm.Enum != nil {
+		parts = append(parts, "enum: "+pm.enumString())
+	}
+	if pm.Pattern != "" {
+		parts = append(parts, "pattern: "+pm.Pattern)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,183 @@
+package convention
+
+import (
+	"fmt"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// Diagnostic 一条带有源码位置的诊断信息
+type Diagnostic struct {
+	Pos token.Position
+	Msg string
+}
+
+func (d Diagnostic) String() string {
+	if !d.Pos.IsValid() {
+		return d.Msg
+	}
+	return d.Pos.String() + ": " + d.Msg
+}
+
+// SignatureError 函数声明不符合约定时的错误，包含所有问题以及修正后的函数声明
+type SignatureError struct {
+	FunName     string
+	Diagnostics []Diagnostic
+	Suggestion  string
+}
+
+func (e *SignatureError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("signature of %s does not follow the convention:", e.FunName))
+	for _, d := range e.Diagnostics {
+		sb.WriteString("\n  ")
+		sb.WriteString(d.String())
+	}
+	sb.WriteString("\ncorrected signature:\n  ")
+	sb.WriteString(e.Suggestion)
+	return sb.String()
+}
+
+// posAt 返回切片中下标i处的位置，越界时返回fallback
+func posAt(positions []token.Position, i int, fallback token.Position) token.Position {
+	if i < len(positions) {
+		return positions[i]
+	}
+	return fallback
+}
+
+// suggestCustomType 为abi下不支持的自定义参数类型给出替代的类型以及改用该类型的方法
+func suggestCustomType(abi, t string) (string, string) {
+	switch t {
+	case "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "rune", "byte":
+		return "int", "use int instead and convert it in the plugin"
+	case "float32", "float64":
+		if slices.Contains(CustomParamTypes[abi], "float64") {
+			return "float64", "use float64 instead and convert it in the plugin"
+		}
+		return "string", "floats are passed in the wrong registers, use string instead and parse it with " +
+			"strconv.ParseFloat"
+	}
+	return "string", "use string instead and pass the value encoded in it(e.g. as JSON)"
+}
+
+// validParamName 参数必须具名（不能是匿名参数或_），生成的包装代码需要通过名字引用参数
+func validParamName(name string) bool {
+	return name != "" && name != "_"
+}
+
+// checkSignature 将函数声明与约定的函数原型比较，返回所有问题以及修正后的函数声明
+func checkSignature(abi, funName string, fd FuncDecl, correctFd FuncDecl, allowCustom bool) ([]Diagnostic, string) {
+	diags := make([]Diagnostic, 0)
+	suggested := make([]Param, 0, len(fd.Params))
+
+	if len(fd.Params) < len(correctFd.Params) {
+		diags = append(diags, Diagnostic{fd.Pos, fmt.Sprintf("argument count not enough, at least %d "+
+			"arguments needed, given %d", len(correctFd.Params), len(fd.Params))})
+	}
+	for i, p := range correctFd.Params {
+		suggested = append(suggested, p)
+		if i >= len(fd.Params) {
+			continue
+		}
+		given := fd.Params[i]
+		if given.Name != p.Name {
+			diags = append(diags, Diagnostic{posAt(fd.ParamPos, i, fd.Pos),
+				fmt.Sprintf("param %d is named %q, wanted %q", i, given.Name, p.Name)})
+		}
+		if given.Type != p.Type {
+			diags = append(diags, Diagnostic{posAt(fd.TypePos, i, fd.Pos),
+				fmt.Sprintf("param %d (%s) has type %s, wanted %s", i, p.Name, given.Type, p.Type)})
+		}
+	}
+
+	// 约定参数之后的为用户自定义参数
+	for i := len(correctFd.Params); i < len(fd.Params); i++ {
+		given := fd.Params[i]
+		fixed := given
+		if !allowCustom {
+			diags = append(diags, Diagnostic{posAt(fd.ParamPos, i, fd.Pos),
+				fmt.Sprintf("unexpected param %d, %s accepts no custom params", i, funName)})
+			continue
+		}
+		if !validParamName(given.Name) {
+			fixed.Name = fmt.Sprintf("arg%d", i)
+			diags = append(diags, Diagnostic{posAt(fd.ParamPos, i, fd.Pos),
+				fmt.Sprintf("custom param %d must be named", i)})
+		}
+		if !slices.Contains(CustomParamTypes[abi], given.Type) {
+			var advice string
+			fixed.Type, advice = suggestCustomType(abi, given.Type)
+			diags = append(diags, Diagnostic{posAt(fd.TypePos, i, fd.Pos),
+				fmt.Sprintf("custom param %d (%s) has type %s, which can't be passed through the %s ABI "+
+					"(supported: %s), %s", i, fixed.Name, given.Type, abi,
+					strings.Join(CustomParamTypes[abi], ", "), advice)})
+		}
+		suggested = append(suggested, fixed)
+	}
+
+	if fd.RetType != correctFd.RetType {
+		given := fd.RetType
+		if given == "" {
+			given = "nothing"
+		}
+		diags = append(diags, Diagnostic{fd.RetPos, fmt.Sprintf("returns %s, wanted %s", given,
+			correctFd.RetType)})
+	}
+
+	return diags, formatSignature(funName, suggested, correctFd.RetType)
+}
+
+// formatSignature 生成函数声明的字符串
+func formatSignature(funName string, params []Param, retType string) string {
+	paraList := make([]string, 0, len(params))
+	for _, p := range params {
+		paraList = append(paraList, p.Name+" "+p.Type)
+	}
+	sig := fmt.Sprintf("func %s(%s)", funName, strings.Join(paraList, ", "))
+	if strings.Contains(retType, ",") {
+		return sig + " (" + retType + ")"
+	} else if retType != "" {
+		return sig + " " + retType
+	}
+	return sig
+}
+
+// CheckPluginFun 判断插件函数的函数声明在abi调用方式下是否符合规范，不符合时返回*SignatureError
+func CheckPluginFun(abi, pluginType string, fd FuncDecl) error {
+	funName := GetPluginFunName(pluginType)
+	diags, suggestion := checkSignature(abi, funName, fd, PluginFunDecl(pluginType, fd), true)
+	if len(diags) == 0 {
+		return nil
+	}
+	return &SignatureError{FunName: funName, Diagnostics: diags, Suggestion: suggestion}
+}
+
+// MinorFunDecl 返回次要插件函数minorFun应有的函数声明，pluginFd为插件函数的声明。包装代码以调用插件函数的
+// 自定义实参调用IterLen与Init，因此IterLen的参数为lengths加上插件函数的自定义参数，Init的参数为插件函数的自定义参数
+func MinorFunDecl(pType, minorFun string, pluginFd FuncDecl) FuncDecl {
+	correctFd := FuncDecls[minorFun]
+	ctxNum := min(len(GetFuncDecl(pType).Params), len(pluginFd.Params))
+	custom := pluginFd.Params[ctxNum:]
+	switch minorFun {
+	case PluginMinorFun[IndPTypeIteratorMinor]:
+		return FuncDecl{Params: append(append([]Param{}, correctFd.Params...), custom...), RetType: correctFd.RetType}
+	case PluginMinorFun[IndInitMinor]:
+		return FuncDecl{Params: append([]Param{}, custom...), RetType: correctFd.RetType}
+	}
+	return correctFd
+}
+
+// CheckPluginMinorFunc 判断次要插件函数minorFun（如IterLen、Init）的函数声明在abi调用方式下是否符合规范，
+// pluginFd为插件函数的声明，应有的声明见MinorFunDecl。不符合时返回*SignatureError
+func CheckPluginMinorFunc(abi, pType, minorFun string, fd FuncDecl, pluginFd FuncDecl) error {
+	if minorFun == PluginMinorFun[IndPTypeIteratorMinor] && pType != PluginTypes[IndPTypeIterator] {
+		return nil
+	}
+	diags, suggestion := checkSignature(abi, minorFun, fd, MinorFunDecl(pType, minorFun, pluginFd), false)
+	if len(diags) == 0 {
+		return nil
+	}
+	return &SignatureError{FunName: minorFun, Diagnostics: diags, Suggestion: suggestion}
+}
@@ -1,26 +1,57 @@
 package convention
 
+import "go/token"
+
 // Param 参数
 type Param struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
 }
 
+// ParaMeta 参数及其注解（见paramAnnotation.go）
 type ParaMeta struct {
-	Param    Param  `json:"param"`
-	ParaInfo string `json:"para_info,omitempty"`
+	Param    Param    `json:"param"`
+	ParaInfo string   `json:"para_info,omitempty"`
+	Default  *string  `json:"default,omitempty"` // 默认值的字面量
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Enum     []string `json:"enum,omitempty"`    // 允许的取值的字面量
+	Pattern  string   `json:"pattern,omitempty"` // 取值需要匹配的正则表达式
 }
 
 // FuncDecl 函数声明
 type FuncDecl struct {
 	Params  []Param
 	RetType string
+	// 以下为源码中的位置，仅在从源码解析时有效，用于输出诊断信息
+	Pos      token.Position   // 函数名
+	ParamPos []token.Position // 每个参数的参数名（匿名参数为其类型）
+	TypePos  []token.Position // 每个参数的类型
+	RetPos   token.Position   // 返回类型（没有返回值时为参数列表的右括号）
 }
 
 type PluginInfo struct {
-	Name      string     `json:"name"`
-	Type      string     `json:"type"`
-	GoVersion string     `json:"go_version"`
-	UsageInfo string     `json:"usage_info,omitempty"`
-	Params    []ParaMeta `json:"params"`
+	Name         string           `json:"name"`
+	Type         string           `json:"type"`
+	Version      string           `json:"version,omitempty"`  // 插件自身的版本（//fgpk:version）
+	Requires     []string         `json:"requires,omitempty"` // 插件要求的FuzzGIU版本（//fgpk:requires）
+	GoVersion    string           `json:"go_version"`
+	UsageInfo    string           `json:"usage_info,omitempty"`
+	Params       []ParaMeta       `json:"params"`
+	ReturnsError bool             `json:"returns_error,omitempty"` // 插件函数是否返回(T, error)
+	Hooks        []string         `json:"hooks,omitempty"`         // 插件定义的生命周期函数（Init、Close）
+	Build        *BuildProvenance `json:"build,omitempty"`
+}
+
+// BuildProvenance 插件的构建来源信息，用于追溯插件由哪次提交、哪次构建产生
+type BuildProvenance struct {
+	FgpkVersion string   `json:"fgpk_version"`
+	Time        string   `json:"time"`               // 构建时间（RFC3339，UTC）
+	VCS         string   `json:"vcs,omitempty"`      // 版本控制系统，目前只支持git
+	Revision    string   `json:"revision,omitempty"` // 提交哈希
+	Dirty       bool     `json:"dirty,omitempty"`    // 工作区是否有未提交的修改
+	SourceHash  string   `json:"source_hash"`        // 参与编译的源文件的sha256
+	Modules     []string `json:"modules,omitempty"`  // go list -m all的输出
+	HostOS      string   `json:"host_os"`
+	HostArch    string   `json:"host_arch"`
 }
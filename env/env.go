@@ -41,18 +41,7 @@ func Check(golangPath ...string) Env {
 	environ.OkToBuild = true
 	if environ.OS == "windows" {
 		// windows采用cgo库编译
-		environ.BuildMode = "-buildmode=c-shared"
-		// 尝试获取gcc版本
-		gcc := exec.Command("gcc", "--version")
-		err := gcc.Run()
-		if err != nil {
-			cc := exec.Command("cc", "--version")
-			err = cc.Run()
-			if err != nil {
-				fmt.Printf("get gcc failed - %v\n", err)
-				environ.OkToBuild = false
-			}
-		}
+		environ.UseCShared()
 	} else { // linux或者macos使用go的plugin包编译
 		environ.BuildMode = "-buildmode=plugin"
 	}
@@ -73,44 +62,33 @@ func Check(golangPath ...string) Env {
 	return environ
 }
 
-// GetBuildArgs 生成go命令使用的命令行参数
-func GetBuildArgs(e Env, out string, goFile string) []string {
+// UseCShared 以c-shared方式编译插件（windows上的默认方式，其它系统上用于测试cgo方式的插件），需要C编译器
+func (e *Env) UseCShared() {
+	e.BuildMode = "-buildmode=c-shared"
+	// 尝试获取gcc版本
+	gcc := exec.Command("gcc", "--version")
+	err := gcc.Run()
+	if err != nil {
+		cc := exec.Command("cc", "--version")
+		err = cc.Run()
+		if err != nil {
+			fmt.Printf("get gcc failed - %v\n", err)
+			e.OkToBuild = false
+		}
+	}
+}
+
+// GetBuildArgs 生成go命令使用的命令行参数，target为编译目标（包路径），flags为额外的构建选项
+func GetBuildArgs(e Env, out string, target string, flags ...string) []string {
 	bf := []string{"build", e.BuildMode}
 	if e.OS == "windows" {
 		bf = append(bf, "-ldflags=-s -w")
 	}
-	bf = append(bf, "-o", out, goFile)
+	bf = append(bf, flags...)
+	bf = append(bf, "-o", out, target)
 	return bf
 }
 
-func RemoveIntermediateFiles(e Env, out string) {
-	// 删除wrapped.go文件
-	fmt.Print("remove wrapped.go...")
-	err := os.Remove("wrapped.go")
-	if err != nil {
-		fmt.Printf("remove wrapped.go failed: %v\n", err)
-	} else {
-		fmt.Println("done")
-	}
-	if e.OS != "windows" {
-		return
-	}
-	// 删除.h文件（windows）
-	hFile := ""
-	if suffix := strings.LastIndex(out, ".dll"); suffix != -1 {
-		hFile = out[:suffix] + ".h"
-	} else {
-		hFile = out + ".h"
-	}
-	fmt.Print("remove ", hFile, "...")
-	err = os.Remove(hFile)
-	if err != nil {
-		fmt.Printf("remove %s failed: %v\n", hFile, err)
-	} else {
-		fmt.Println("done")
-	}
-}
-
 func GetCwd() string {
 	cwd, _ := os.Getwd()
 	if cwd == "" {
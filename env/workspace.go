@@ -0,0 +1,112 @@
+package env
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Workspace 构建插件时使用的临时工作区。中间文件、go.mod副本与编译产物都放在工作区中，
+// 再通过go build的-overlay与-modfile选项参与编译，因此用户的源码目录不会被修改
+type Workspace struct {
+	Dir     string
+	overlay map[string]string
+}
+
+// NewWorkspace 在系统临时目录下创建工作区
+func NewWorkspace() (*Workspace, error) {
+	dir, err := os.MkdirTemp("", "fgpk-build-")
+	if err != nil {
+		return nil, err
+	}
+	return &Workspace{Dir: dir, overlay: make(map[string]string)}, nil
+}
+
+// Path 返回工作区中文件的路径
+func (w *Workspace) Path(name string) string {
+	return filepath.Join(w.Dir, name)
+}
+
+// WriteFile 在工作区中写入文件，返回文件路径
+func (w *Workspace) WriteFile(name string, content []byte) (string, error) {
+	p := w.Path(name)
+	return p, os.WriteFile(p, content, 0644)
+}
+
+// CopyIn 将文件复制到工作区中，返回复制后的路径
+func (w *Workspace) CopyIn(src string, name string) (string, error) {
+	dst := w.Path(name)
+	return dst, CopyFile(src, dst)
+}
+
+// Overlay 令编译时src的内容被替换为工作区中的replacement，replacement为空则表示编译时忽略src
+func (w *Workspace) Overlay(src string, replacement string) {
+	src, _ = filepath.Abs(src)
+	w.overlay[src] = replacement
+}
+
+// WriteOverlay 生成-overlay选项使用的json文件，返回文件路径
+func (w *Workspace) WriteOverlay() (string, error) {
+	j, err := json.Marshal(struct {
+		Replace map[string]string
+	}{w.overlay})
+	if err != nil {
+		return "", err
+	}
+	return w.WriteFile("overlay.json", j)
+}
+
+// Remove 删除工作区
+func (w *Workspace) Remove() error {
+	return os.RemoveAll(w.Dir)
+}
+
+// CopyFile 复制文件（工作区与目标目录可能不在同一个文件系统上，所以不能直接rename）
+func CopyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// FindModRoot 从dir开始向上查找go.mod所在的目录，找不到时返回空字符串
+func FindModRoot(dir string) string {
+	dir, _ = filepath.Abs(dir)
+	for {
+		if fi, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !fi.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ModulePath 读取go.mod中声明的模块路径，读取失败时返回空字符串
+func ModulePath(modRoot string) string {
+	b, err := os.ReadFile(filepath.Join(modRoot, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "module") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(l, "module")), `"`)
+		}
+	}
+	return ""
+}
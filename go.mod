@@ -5,6 +5,7 @@ go 1.25.0
 require (
 	github.com/nostalgist134/FuzzGIU v0.2.8-4
 	github.com/spf13/cobra v1.9.1
+	golang.org/x/term v0.37.0
 )
 
 require (
@@ -34,6 +35,5 @@ require (
 	golang.org/x/crypto v0.44.0 // indirect
 	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
-	golang.org/x/term v0.37.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
 )
@@ -0,0 +1,55 @@
+package goParser
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// DirectivePrefix fgpk指令的前缀，与go自身的指令（//go:build等）一样，双斜杠与前缀之间不能有空格
+const DirectivePrefix = "//fgpk:"
+
+// Directive 源码中的一条fgpk指令，如//fgpk:version 1.4.0
+type Directive struct {
+	Name  string
+	Value string
+	Pos   token.Position
+}
+
+// FindDirectives 返回源文件中的所有fgpk指令，指令可以出现在文件的任意注释中
+func FindDirectives(files []string) ([]Directive, error) {
+	directives := make([]Directive, 0)
+	fset := token.NewFileSet()
+	for _, f := range files {
+		node, err := parser.ParseFile(fset, f, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, cg := range node.Comments {
+			for _, c := range cg.List {
+				if !strings.HasPrefix(c.Text, DirectivePrefix) {
+					continue
+				}
+				body := strings.TrimPrefix(c.Text, DirectivePrefix)
+				name, value, _ := strings.Cut(body, " ")
+				directives = append(directives, Directive{
+					Name:  name,
+					Value: strings.TrimSpace(value),
+					Pos:   fset.Position(c.Slash),
+				})
+			}
+		}
+	}
+	return directives, nil
+}
+
+// Directives 返回指定名称的所有指令
+func Directives(directives []Directive, name string) []Directive {
+	found := make([]Directive, 0)
+	for _, d := range directives {
+		if d.Name == name {
+			found = append(found, d)
+		}
+	}
+	return found
+}
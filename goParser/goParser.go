@@ -1,14 +1,16 @@
 package goParser
 
 import (
-	"bytes"
 	"fmt"
 	"github.com/nostalgist134/FuzzGIUPluginKit/convention"
 	"go/ast"
-	"go/format"
+	"go/build"
 	"go/parser"
 	"go/token"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -25,6 +27,7 @@ func FindFunction(filePath, funcName string) (*convention.FuncDecl, []convention
 
 	var funcDeclResult *convention.FuncDecl
 	var paraMetas []convention.ParaMeta
+	tp := newTypePrinter(fset, node)
 
 	// 遍历AST查找函数声明
 	ast.Inspect(node, func(n ast.Node) bool {
@@ -39,18 +42,27 @@ func FindFunction(filePath, funcName string) (*convention.FuncDecl, []convention
 			return true
 		}
 
-		// 检查函数名是否匹配
-		if funcDecl.Name.Name == funcName {
+		// 检查函数名是否匹配，方法（如辅助类型的Close方法）不是插件函数
+		if funcDecl.Recv == nil && funcDecl.Name.Name == funcName {
 			// 提取函数参数和参数元信息
-			params, metas := extractParamsWithComments(funcDecl.Type.Params, node.Comments)
+			var params []convention.Param
+			var metas []convention.ParaMeta
+			var retType string
+			params, metas, err = extractParamsWithComments(tp, funcDecl.Type.Params, node.Comments)
+			if err != nil {
+				return false
+			}
 
 			// 提取返回类型
-			retType := extractReturnType(funcDecl.Type.Results)
+			if retType, err = extractReturnType(tp, funcDecl.Type.Results); err != nil {
+				return false
+			}
 
 			funcDeclResult = &convention.FuncDecl{
 				Params:  params,
 				RetType: retType,
 			}
+			fillPositions(fset, funcDecl, funcDeclResult)
 			paraMetas = metas
 			return false // 找到后停止遍历
 		}
@@ -58,6 +70,9 @@ func FindFunction(filePath, funcName string) (*convention.FuncDecl, []convention
 		return true
 	})
 
+	if err != nil {
+		return nil, nil, err
+	}
 	if funcDeclResult == nil {
 		return nil, nil, os.ErrNotExist // 函数未找到
 	}
@@ -65,59 +80,111 @@ func FindFunction(filePath, funcName string) (*convention.FuncDecl, []convention
 	return funcDeclResult, paraMetas, nil
 }
 
-// GetCode 读取Go源文件，返回除去package和import语句之外的所有内容
-func GetCode(filePath string) (string, error) {
-	// 创建文件集
-	fset := token.NewFileSet()
+// fillPositions 记录函数名、参数与返回类型在源码中的位置，用于输出诊断信息
+func fillPositions(fset *token.FileSet, funcDecl *ast.FuncDecl, fd *convention.FuncDecl) {
+	fd.Pos = fset.Position(funcDecl.Name.Pos())
+	for _, field := range funcDecl.Type.Params.List {
+		typePos := fset.Position(field.Type.Pos())
+		if len(field.Names) == 0 {
+			fd.ParamPos = append(fd.ParamPos, typePos)
+			fd.TypePos = append(fd.TypePos, typePos)
+			continue
+		}
+		for _, name := range field.Names {
+			fd.ParamPos = append(fd.ParamPos, fset.Position(name.Pos()))
+			fd.TypePos = append(fd.TypePos, typePos)
+		}
+	}
+	if res := funcDecl.Type.Results; res != nil && len(res.List) > 0 {
+		fd.RetPos = fset.Position(res.Pos())
+	} else {
+		fd.RetPos = fset.Position(funcDecl.Type.Params.Closing)
+	}
+}
 
-	// 解析Go源文件
-	node, err := parser.ParseFile(fset, filePath, nil, parser.ParseComments)
+// PackageFiles 返回目录中参与构建的全部go源文件（遵循构建约束，不含测试文件），exclude中的文件名会被跳过
+func PackageFiles(dir string, exclude ...string) ([]string, error) {
+	absDir, err := filepath.Abs(dir)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	// 用于存储过滤后的声明
-	var filteredDecls []ast.Decl
-
-	// 遍历所有声明，过滤掉package和import语句
-	for _, decl := range node.Decls {
-		// 检查是否为package声明
-		if genDecl, ok := decl.(*ast.GenDecl); ok {
-			// 处理package声明
-			if genDecl.Tok == token.PACKAGE {
-				continue // 跳过package声明
-			}
-			// 处理import声明
-			if genDecl.Tok == token.IMPORT {
-				continue // 跳过import声明
+	pkg, err := build.ImportDir(absDir, 0)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(pkg.GoFiles)+len(pkg.CgoFiles))
+	for _, f := range append(pkg.GoFiles, pkg.CgoFiles...) {
+		skip := false
+		for _, e := range exclude {
+			if f == e {
+				skip = true
+				break
 			}
 		}
+		if !skip {
+			files = append(files, filepath.Join(absDir, f))
+		}
+	}
+	return files, nil
+}
 
-		// 保留其他所有声明
-		filteredDecls = append(filteredDecls, decl)
+// FindFunctionInFiles 在多个源文件中查找函数，额外返回函数所在的文件
+func FindFunctionInFiles(files []string, funcName string) (*convention.FuncDecl, []convention.ParaMeta, string, error) {
+	for _, f := range files {
+		fd, paraMeta, err := FindFunction(f, funcName)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return fd, paraMeta, f, nil
 	}
+	return nil, nil, "", os.ErrNotExist
+}
 
-	// 创建新的文件节点
-	newFile := &ast.File{
-		Name:     node.Name, // 保留包名（但移除了package语句）
-		Decls:    filteredDecls,
-		Comments: node.Comments, // 保留注释
+// GetCodeWithLines 读取Go源文件，返回除去package和import语句之外的声明的原始文本，并在每个声明前插入//line指令，使编译错误与栈回溯指向原文件的行号
+func GetCodeWithLines(filePath string) (string, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+	src, err := os.ReadFile(absPath)
+	if err != nil {
+		return "", err
 	}
 
-	// 将AST转换回代码
-	var buf bytes.Buffer
-	if err := format.Node(&buf, fset, newFile); err != nil {
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, absPath, src, parser.ParseComments)
+	if err != nil {
 		return "", err
 	}
-	ret := buf.String()
-	if strings.Index(ret, "package") == 0 {
-		if len(strings.Split(ret, "\n")) > 1 {
-			ret = ret[strings.Index(ret, "\n"):]
-		} else {
-			ret = ""
+
+	sb := strings.Builder{}
+	for _, decl := range node.Decls {
+		start := decl.Pos()
+		// 跳过import语句，并保留声明的文档注释
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
 		}
+		startPos := fset.Position(start)
+		endPos := fset.Position(decl.End())
+		fmt.Fprintf(&sb, "//line %s:%d:1\n", absPath, startPos.Line)
+		sb.WriteString(strings.Repeat(" ", startPos.Column-1))
+		sb.Write(src[startPos.Offset:endPos.Offset])
+		sb.WriteString("\n\n")
 	}
-	return ret, nil
+	return sb.String(), nil
 }
 
 // GetImports 提取文件中的import列表
@@ -156,18 +223,78 @@ func GetImports(filename string, asSource ...bool) ([]string, error) {
 	return imports, nil
 }
 
+// SplitImports 将源码拆分为import列表（格式与GetImports相同）与import之后的声明部分，用于将辅助代码追加到其它源文件中
+func SplitImports(src string) ([]string, string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, "", err
+	}
+	imports := make([]string, 0, len(file.Imports))
+	for _, imp := range file.Imports {
+		if imp.Name != nil {
+			imports = append(imports, fmt.Sprintf("%s %s", imp.Name.Name, imp.Path.Value))
+		} else {
+			imports = append(imports, imp.Path.Value)
+		}
+	}
+	end := file.Name.End()
+	for _, decl := range file.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			end = gd.End()
+		}
+	}
+	return imports, src[fset.Position(end).Offset:], nil
+}
+
+// DeclaredNames 返回源码中包级别声明的所有名字（函数、类型、变量与常量，不包括方法）
+func DeclaredNames(src string) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				names = append(names, d.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, sp.Name.Name)
+				case *ast.ValueSpec:
+					for _, n := range sp.Names {
+						names = append(names, n.Name)
+					}
+				}
+			}
+		}
+	}
+	return names, nil
+}
+
 // 提取函数参数及相关注释信息
-func extractParamsWithComments(fieldList *ast.FieldList, comments []*ast.CommentGroup) ([]convention.Param,
-	[]convention.ParaMeta) {
+func extractParamsWithComments(tp *typePrinter, fieldList *ast.FieldList, comments []*ast.CommentGroup) (
+	[]convention.Param, []convention.ParaMeta, error) {
 	var params []convention.Param
 	var paraMetas []convention.ParaMeta
 
 	if fieldList == nil {
-		return params, paraMetas
+		return params, paraMetas, nil
+	}
+
+	if err := checkMisplacedAnnotations(tp, fieldList, comments); err != nil {
+		return nil, nil, err
 	}
 
 	for _, field := range fieldList.List {
-		typeStr := getTypeString(field.Type)
+		typeStr, err := tp.typeString(field.Type)
+		if err != nil {
+			return nil, nil, err
+		}
 
 		// 获取参数名和类型的位置信息
 		var namePos, typePos token.Pos
@@ -179,8 +306,8 @@ func extractParamsWithComments(fieldList *ast.FieldList, comments []*ast.Comment
 		}
 		typePos = field.Type.Pos()
 
-		// 查找参数名和类型之间的INFO注释
-		infoComment := findInfoCommentBetween(namePos, typePos, comments)
+		// 查找参数名和类型之间的注解注释
+		annots := findAnnotationsBetween(namePos, typePos, comments)
 
 		// 处理多个参数名共享同一类型的情况
 		if len(field.Names) == 0 {
@@ -191,11 +318,12 @@ func extractParamsWithComments(fieldList *ast.FieldList, comments []*ast.Comment
 			}
 			params = append(params, param)
 
-			// 无论infoComment是否为空，都添加到元信息
-			paraMetas = append(paraMetas, convention.ParaMeta{
-				Param:    param,
-				ParaInfo: infoComment, // 可能为空字符串
-			})
+			// 无论是否有注解，都添加到元信息
+			meta, err := annotatedParaMeta(tp, param, annots)
+			if err != nil {
+				return nil, nil, err
+			}
+			paraMetas = append(paraMetas, meta)
 		} else {
 			for _, name := range field.Names {
 				param := convention.Param{
@@ -204,96 +332,136 @@ func extractParamsWithComments(fieldList *ast.FieldList, comments []*ast.Comment
 				}
 				params = append(params, param)
 
-				// 无论infoComment是否为空，都添加到元信息
-				paraMetas = append(paraMetas, convention.ParaMeta{
-					Param:    param,
-					ParaInfo: infoComment, // 可能为空字符串
-				})
+				// 无论是否有注解，都添加到元信息
+				meta, err := annotatedParaMeta(tp, param, annots)
+				if err != nil {
+					return nil, nil, err
+				}
+				paraMetas = append(paraMetas, meta)
 			}
 		}
 	}
 
-	return params, paraMetas
+	return params, paraMetas, nil
 }
 
-// 在指定位置之间查找INFO注释
-func findInfoCommentBetween(start, end token.Pos, comments []*ast.CommentGroup) string {
+// annotation 参数名与类型之间形如/*KEY: value*/的注解注释
+type annotation struct {
+	key string
+	val string
+	pos token.Pos
+}
+
+// annotationPattern 匹配注解注释，注解名为大写字母
+var annotationPattern = regexp.MustCompile(`(?s)^/\*([A-Z]+):(.*)\*/$`)
+
+// 在指定位置之间查找注解注释（INFO、DEFAULT、MIN等，见convention.ParamAnnotations）
+func findAnnotationsBetween(start, end token.Pos, comments []*ast.CommentGroup) []annotation {
+	annots := make([]annotation, 0)
 	for _, commentGroup := range comments {
 		for _, comment := range commentGroup.List {
 			// 检查注释是否在参数名和类型之间
-			if comment.Pos() >= start && comment.End() <= end {
-				// 检查是否是INFO注释
-				text := comment.Text
-				if strings.HasPrefix(text, "/*INFO:") && strings.HasSuffix(text, "*/") {
-					// 提取INFO内容
-					info := strings.TrimPrefix(text, "/*INFO:")
-					info = strings.TrimSuffix(info, "*/")
-					return strings.TrimSpace(info)
-				}
+			if comment.Pos() < start || comment.End() > end {
+				continue
 			}
+			m := annotationPattern.FindStringSubmatch(comment.Text)
+			if m == nil {
+				continue
+			}
+			annots = append(annots, annotation{key: m[1], val: strings.TrimSpace(m[2]), pos: comment.Pos()})
 		}
 	}
+	return annots
+}
 
-	return ""
+// checkMisplacedAnnotations 检查参数列表中是否有不在参数名与类型之间的注解注释（如写在类型之后），
+// 这样的注解不会生效，报告为错误以免被忽略
+func checkMisplacedAnnotations(tp *typePrinter, fieldList *ast.FieldList, comments []*ast.CommentGroup) error {
+	if !fieldList.Opening.IsValid() || !fieldList.Closing.IsValid() {
+		return nil
+	}
+	for _, a := range findAnnotationsBetween(fieldList.Opening, fieldList.Closing, comments) {
+		if !slices.Contains(convention.ParamAnnotations, a.key) {
+			continue
+		}
+		placed := false
+		for _, field := range fieldList.List {
+			if len(field.Names) > 0 && a.pos > field.Names[0].Pos() && a.pos < field.Type.Pos() {
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			return fmt.Errorf("%s: misplaced annotation %s, annotations must be written between the param name "+
+				"and its type, e.g. n /*%s: ...*/ int", tp.fset.Position(a.pos), a.key, a.key)
+		}
+	}
+	return nil
 }
 
-// 提取返回类型
-func extractReturnType(fieldList *ast.FieldList) string {
-	if fieldList == nil || len(fieldList.List) == 0 {
-		return ""
+// annotatedParaMeta 将注解写入参数元信息，并检查注解是否适用于参数
+func annotatedParaMeta(tp *typePrinter, param convention.Param, annots []annotation) (convention.ParaMeta, error) {
+	meta := convention.ParaMeta{Param: param}
+	for _, a := range annots {
+		if err := meta.SetAnnotation(a.key, a.val); err != nil {
+			return meta, fmt.Errorf("%s: param %s: %v", tp.fset.Position(a.pos), param.Name, err)
+		}
 	}
+	// 只有带注解的参数才可能检查失败
+	if err := meta.CheckAnnotations(); err != nil {
+		return meta, fmt.Errorf("%s: param %s: %v", tp.fset.Position(annots[0].pos), param.Name, err)
+	}
+	return meta, nil
+}
 
-	// 处理多个返回值的情况
-	var types []string
-	for _, field := range fieldList.List {
-		types = append(types, getTypeString(field.Type))
+// 提取返回类型，多个返回值以", "分隔
+func extractReturnType(tp *typePrinter, fieldList *ast.FieldList) (string, error) {
+	if fieldList == nil || len(fieldList.List) == 0 {
+		return "", nil
 	}
+	return tp.fieldList(fieldList)
+}
 
-	return strings.Join(types, ", ")
+// FuncAST 函数声明的语法树，以及其所在文件的语法树与源码，用于改写函数
+type FuncAST struct {
+	Fset *token.FileSet
+	File *ast.File
+	Decl *ast.FuncDecl
+	Src  []byte
 }
 
-// 将AST类型表达式转换为字符串
-func getTypeString(expr ast.Expr) string {
-	switch t := expr.(type) {
-	case *ast.Ident:
-		return t.Name
-	case *ast.StarExpr:
-		return "*" + getTypeString(t.X)
-	case *ast.ArrayType:
-		if t.Len != nil {
-			// 固定长度数组
-			return "[" + t.Len.(*ast.BasicLit).Value + "]" + getTypeString(t.Elt)
-		}
-		// 切片
-		return "[]" + getTypeString(t.Elt)
-	case *ast.MapType:
-		return "map[" + getTypeString(t.Key) + "]" + getTypeString(t.Value)
-	case *ast.ChanType:
-		dir := ""
-		switch t.Dir {
-		case ast.SEND:
-			dir = "<-"
-		case ast.RECV:
-			dir = "<-"
-		}
-		return "chan " + dir + getTypeString(t.Value)
-	case *ast.FuncType:
-		// 函数类型
-		params, _ := extractParamsWithComments(t.Params, nil)
-		var paramStrs []string
-		for _, p := range params {
-			paramStrs = append(paramStrs, p.Type)
+// FindFuncAST 在源文件中查找函数，返回其语法树。src不为nil时使用src作为文件内容（例如已经改写过的源码）
+func FindFuncAST(filePath string, src []byte, funcName string) (*FuncAST, error) {
+	var err error
+	if src == nil {
+		if src, err = os.ReadFile(filePath); err != nil {
+			return nil, err
 		}
-		retType := extractReturnType(t.Results)
-		if retType != "" {
-			return "func(" + strings.Join(paramStrs, ", ") + ") " + retType
+	}
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, filePath, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, decl := range node.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Name.Name == funcName {
+			return &FuncAST{Fset: fset, File: node, Decl: fd, Src: src}, nil
 		}
-		return "func(" + strings.Join(paramStrs, ", ") + ")"
-	case *ast.SelectorExpr:
-		// 处理包名.类型的情况，如time.Time
-		return getTypeString(t.X) + "." + t.Sel.Name
 	}
+	return nil, os.ErrNotExist
+}
+
+// Offset 返回位置在源码中的字节偏移
+func (fa *FuncAST) Offset(pos token.Pos) int {
+	return fa.Fset.Position(pos).Offset
+}
+
+// Text 返回语法树节点对应的源码
+func (fa *FuncAST) Text(n ast.Node) string {
+	return string(fa.Src[fa.Offset(n.Pos()):fa.Offset(n.End())])
+}
 
-	// 如果遇到未处理的类型，返回空字符串或占位符
-	return ""
+// TypeString 将函数所在文件中的类型表达式转换为规范的字符串（导入别名会被还原）
+func (fa *FuncAST) TypeString(expr ast.Expr) (string, error) {
+	return newTypePrinter(fa.Fset, fa.File).typeString(expr)
 }
@@ -0,0 +1,108 @@
+package goParser
+
+import (
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TypedPackage 经过go/types类型检查的包
+type TypedPackage struct {
+	Fset      *token.FileSet
+	Files     []*ast.File
+	Pkg       *types.Package
+	Info      *types.Info
+	Errors    []types.Error // 类型错误
+	ImportErr []types.Error // 依赖包无法导入的错误，这些包中的类型均无法确定
+}
+
+// isImportError 判断是否为依赖包无法导入导致的错误
+func isImportError(e types.Error) bool {
+	return strings.HasPrefix(e.Msg, "could not import ")
+}
+
+// TypeCheck 解析并类型检查同一个包中的源文件。依赖包从源码导入，在dir下通过go list定位，
+// modFile不为空时以-modfile指定go.mod（与编译时使用的go.mod副本一致）
+func TypeCheck(dir string, files []string, modFile string) (*TypedPackage, error) {
+	tp := &TypedPackage{Fset: token.NewFileSet()}
+	for _, f := range files {
+		file, err := parser.ParseFile(tp.Fset, f, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		tp.Files = append(tp.Files, file)
+	}
+
+	// 源码导入器使用build.Default，go list在其Dir下执行，-modfile只能通过GOFLAGS传入
+	oldDir, oldFlags := build.Default.Dir, os.Getenv("GOFLAGS")
+	build.Default.Dir = dir
+	if modFile != "" {
+		os.Setenv("GOFLAGS", strings.TrimSpace(oldFlags+" -modfile="+modFile))
+	}
+	defer func() {
+		build.Default.Dir = oldDir
+		os.Setenv("GOFLAGS", oldFlags)
+	}()
+
+	conf := types.Config{
+		Importer:    importer.ForCompiler(tp.Fset, "source", nil),
+		FakeImportC: true,
+		Error: func(err error) {
+			if e, ok := err.(types.Error); ok {
+				if isImportError(e) {
+					tp.ImportErr = append(tp.ImportErr, e)
+				} else {
+					tp.Errors = append(tp.Errors, e)
+				}
+			}
+		},
+	}
+	tp.Info = &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	pkgName := ""
+	if len(tp.Files) > 0 {
+		pkgName = tp.Files[0].Name.Name
+	}
+	// 类型错误已由Error回调收集，返回的错误只是其中第一个
+	tp.Pkg, _ = conf.Check(pkgName, tp.Fset, tp.Files, tp.Info)
+	return tp, nil
+}
+
+// Qualifier 以包名限定类型名（如fuzzTypes.Req），与源码中的写法以及约定中的类型字符串一致
+func Qualifier(p *types.Package) string {
+	return p.Name()
+}
+
+// ImportNames 返回源码中import语句在文件作用域中声明的名字与对应的导入路径（_与.导入不声明名字）
+func ImportNames(src string) (map[string]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string)
+	for _, imp := range file.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := canonicalPkgName(path)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		names[name] = path
+	}
+	return names, nil
+}
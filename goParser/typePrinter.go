@@ -0,0 +1,263 @@
+package goParser
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// typePrinter 将类型表达式转换为规范的字符串，导入别名会被还原为包的规范名称（如ft.Req还原为fuzzTypes.Req）
+type typePrinter struct {
+	fset    *token.FileSet
+	aliases map[string]string // 导入别名 -> 包的规范名称
+}
+
+// canonicalPkgName 根据导入路径推断包的规范名称：取路径最后一段，忽略主版本号后缀（/v2）与gopkg.in风格的版本后缀（.v3）
+func canonicalPkgName(path string) string {
+	parts := strings.Split(path, "/")
+	name := parts[len(parts)-1]
+	if len(parts) > 1 && len(name) > 1 && name[0] == 'v' {
+		if _, err := strconv.Atoi(name[1:]); err == nil {
+			name = parts[len(parts)-2]
+		}
+	}
+	if strings.HasPrefix(path, "gopkg.in/") {
+		if ind := strings.Index(name, ".v"); ind != -1 {
+			name = name[:ind]
+		}
+	}
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+func newTypePrinter(fset *token.FileSet, file *ast.File) *typePrinter {
+	tp := &typePrinter{fset: fset, aliases: make(map[string]string)}
+	if file == nil {
+		return tp
+	}
+	for _, imp := range file.Imports {
+		if imp.Name == nil || imp.Name.Name == "_" || imp.Name.Name == "." {
+			continue
+		}
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		tp.aliases[imp.Name.Name] = canonicalPkgName(path)
+	}
+	return tp
+}
+
+func (tp *typePrinter) unsupported(expr ast.Expr, what string) error {
+	return fmt.Errorf("%s: unsupported type expression %s (%s)", tp.fset.Position(expr.Pos()),
+		types.ExprString(expr), what)
+}
+
+// typeStrings 转换多个类型表达式
+func (tp *typePrinter) typeStrings(exprs []ast.Expr) ([]string, error) {
+	strs := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		s, err := tp.typeString(e)
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+// fieldList 转换参数列表或返回值列表，省略参数名，多个参数共享同一类型时（a, b int）展开为多项
+func (tp *typePrinter) fieldList(fl *ast.FieldList) (string, error) {
+	if fl == nil {
+		return "", nil
+	}
+	items := make([]string, 0, len(fl.List))
+	for _, f := range fl.List {
+		t, err := tp.typeString(f.Type)
+		if err != nil {
+			return "", err
+		}
+		if len(f.Names) == 0 {
+			items = append(items, t)
+			continue
+		}
+		for range f.Names {
+			items = append(items, t)
+		}
+	}
+	return strings.Join(items, ", "), nil
+}
+
+// funcSignature 转换函数签名（不含func关键字），参数名被省略
+func (tp *typePrinter) funcSignature(ft *ast.FuncType) (string, error) {
+	if ft.TypeParams != nil {
+		return "", tp.unsupported(ft, "generic function type")
+	}
+	params, err := tp.fieldList(ft.Params)
+	if err != nil {
+		return "", err
+	}
+	sig := "(" + params + ")"
+	if ft.Results == nil || len(ft.Results.List) == 0 {
+		return sig, nil
+	}
+	results, err := tp.fieldList(ft.Results)
+	if err != nil {
+		return "", err
+	}
+	if len(ft.Results.List) == 1 && len(ft.Results.List[0].Names) <= 1 {
+		return sig + " " + results, nil
+	}
+	return sig + " (" + results + ")", nil
+}
+
+// typeString 将类型表达式转换为字符串，遇到无法表示类型的表达式时返回错误
+func (tp *typePrinter) typeString(expr ast.Expr) (string, error) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name, nil
+	case *ast.ParenExpr:
+		return tp.typeString(t.X)
+	case *ast.StarExpr:
+		x, err := tp.typeString(t.X)
+		return "*" + x, err
+	case *ast.SelectorExpr:
+		pkg, ok := t.X.(*ast.Ident)
+		if !ok {
+			return "", tp.unsupported(expr, "qualified identifier expected")
+		}
+		name := pkg.Name
+		if canonical, ok := tp.aliases[name]; ok {
+			name = canonical
+		}
+		return name + "." + t.Sel.Name, nil
+	case *ast.ArrayType:
+		elt, err := tp.typeString(t.Elt)
+		if err != nil {
+			return "", err
+		}
+		if t.Len == nil {
+			return "[]" + elt, nil
+		}
+		if _, ok := t.Len.(*ast.Ellipsis); ok {
+			return "", tp.unsupported(expr, "[...] array is only allowed in composite literals")
+		}
+		// 数组长度可以是字面量、常量或常量表达式
+		return "[" + types.ExprString(t.Len) + "]" + elt, nil
+	case *ast.Ellipsis:
+		if t.Elt == nil {
+			return "", tp.unsupported(expr, "missing element type")
+		}
+		elt, err := tp.typeString(t.Elt)
+		return "..." + elt, err
+	case *ast.MapType:
+		key, err := tp.typeString(t.Key)
+		if err != nil {
+			return "", err
+		}
+		val, err := tp.typeString(t.Value)
+		return "map[" + key + "]" + val, err
+	case *ast.ChanType:
+		val, err := tp.typeString(t.Value)
+		if err != nil {
+			return "", err
+		}
+		switch t.Dir {
+		case ast.SEND:
+			return "chan<- " + val, nil
+		case ast.RECV:
+			return "<-chan " + val, nil
+		}
+		// chan (<-chan int)需要括号，否则会被解析为chan<- chan int
+		if inner, ok := ast.Unparen(t.Value).(*ast.ChanType); ok && inner.Dir == ast.RECV {
+			return "chan (" + val + ")", nil
+		}
+		return "chan " + val, nil
+	case *ast.FuncType:
+		sig, err := tp.funcSignature(t)
+		return "func" + sig, err
+	case *ast.InterfaceType:
+		if t.Methods == nil || len(t.Methods.List) == 0 {
+			return "interface{}", nil
+		}
+		items := make([]string, 0, len(t.Methods.List))
+		for _, m := range t.Methods.List {
+			if len(m.Names) == 0 { // 嵌入的接口或类型约束
+				s, err := tp.typeString(m.Type)
+				if err != nil {
+					return "", err
+				}
+				items = append(items, s)
+				continue
+			}
+			ft, ok := m.Type.(*ast.FuncType)
+			if !ok {
+				return "", tp.unsupported(expr, "invalid interface method")
+			}
+			sig, err := tp.funcSignature(ft)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, m.Names[0].Name+sig)
+		}
+		return "interface{ " + strings.Join(items, "; ") + " }", nil
+	case *ast.StructType:
+		if t.Fields == nil || len(t.Fields.List) == 0 {
+			return "struct{}", nil
+		}
+		items := make([]string, 0, len(t.Fields.List))
+		for _, f := range t.Fields.List {
+			s, err := tp.typeString(f.Type)
+			if err != nil {
+				return "", err
+			}
+			if len(f.Names) > 0 {
+				names := make([]string, 0, len(f.Names))
+				for _, n := range f.Names {
+					names = append(names, n.Name)
+				}
+				s = strings.Join(names, ", ") + " " + s
+			}
+			if f.Tag != nil {
+				s += " " + f.Tag.Value
+			}
+			items = append(items, s)
+		}
+		return "struct{ " + strings.Join(items, "; ") + " }", nil
+	case *ast.IndexExpr:
+		x, err := tp.typeString(t.X)
+		if err != nil {
+			return "", err
+		}
+		idx, err := tp.typeString(t.Index)
+		return x + "[" + idx + "]", err
+	case *ast.IndexListExpr:
+		x, err := tp.typeString(t.X)
+		if err != nil {
+			return "", err
+		}
+		indices, err := tp.typeStrings(t.Indices)
+		return x + "[" + strings.Join(indices, ", ") + "]", err
+	case *ast.UnaryExpr:
+		// 类型约束中的~T
+		if t.Op == token.TILDE {
+			x, err := tp.typeString(t.X)
+			return "~" + x, err
+		}
+	case *ast.BinaryExpr:
+		// 类型约束中的A | B
+		if t.Op == token.OR {
+			x, err := tp.typeString(t.X)
+			if err != nil {
+				return "", err
+			}
+			y, err := tp.typeString(t.Y)
+			return x + " | " + y, err
+		}
+	case nil:
+		return "", fmt.Errorf("missing type expression")
+	}
+	return "", tp.unsupported(expr, fmt.Sprintf("%T", expr))
+}
@@ -0,0 +1,107 @@
+package tmpl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// CodeMarker 包装代码中插件源码的位置。源码需要在格式化之后带着//line指令原样粘贴，因此渲染时只留下此标记
+const CodeMarker = "/* FGPK PLUGIN CODE */"
+
+// CustomParam 插件函数在约定参数之后的自定义参数
+type CustomParam struct {
+	Name     string // 参数名
+	Type     string // 参数类型
+	Index    int    // 在插件函数参数列表中的下标
+	ArgIndex int    // plugin方式下在PluginWrapper的args中的下标
+	Coerce   string // plugin方式下将args中的值转换为参数类型的函数
+}
+
+// Wrapper 渲染包装代码模板的数据
+type Wrapper struct {
+	FunName      string        // 插件函数名
+	MinorFunName string        // 次要插件函数名（iterator的IterLen）
+	Imports      []string      // 模板之外需要导入的包（插件源码与辅助函数的import，格式与goParser.GetImports相同）
+	Params       []CustomParam // 自定义参数
+	Recover      bool          // 是否捕获插件函数的panic
+	Init         bool          // 是否在调用插件函数之前调用Init（插件定义了生命周期函数）
+	RetErr       bool          // 插件函数是否返回(T, error)
+	Code         string        // 插件源码，通常为CodeMarker
+}
+
+// PluginInfo 渲染PluginInfo模板的数据
+type PluginInfo struct {
+	Raw      string // 前后带有标记的元信息，已加引号
+	BeginLen int    // 开始标记的长度
+	EndLen   int    // 结束标记的长度
+}
+
+// placeholderRe 匹配旧式的/* XXX */占位符，模板改用text/template后不应再出现
+var placeholderRe = regexp.MustCompile(`/\*\s*[A-Z][A-Z_ ]*\s*\*/`)
+
+// render 使用text/template渲染模板，模板中残留旧式占位符或引用不存在的字段时返回错误。
+// 占位符在模板文本而不是渲染结果中查找，插件源码、用法信息等数据中恰好形如占位符的注释不会被误报
+func render(name string, src string, defs string, data any) (string, error) {
+	if left := placeholderRe.FindAllString(src+defs, -1); len(left) > 0 {
+		return "", fmt.Errorf("template %s: placeholders left unreplaced: %s", name, strings.Join(left, ", "))
+	}
+	t := template.New(name).Option("missingkey=error")
+	if defs != "" {
+		if _, err := t.New("defs").Parse(defs); err != nil {
+			return "", err
+		}
+	}
+	if _, err := t.Parse(src); err != nil {
+		return "", err
+	}
+	sb := strings.Builder{}
+	if err := t.ExecuteTemplate(&sb, name, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// RenderWrapper 渲染插件类型pType的包装代码模板，各插件类型的模板共用同一目录下Defs模板中的定义
+func RenderWrapper(abi, pType string, data Wrapper) (string, error) {
+	src, err := GetTemplate(abi, pType)
+	if err != nil {
+		return "", err
+	}
+	defs, err := GetTemplate(abi, "defs")
+	if err != nil {
+		return "", err
+	}
+	return render(pType, src, defs, data)
+}
+
+// RenderHelper 渲染追加到包装代码中的辅助模板name，模板可以引用abi的Defs模板中的定义（如lifecycleExports）
+func RenderHelper(abi, name string) (string, error) {
+	src, err := GetTemplate(abi, name)
+	if err != nil {
+		return "", err
+	}
+	defs, err := GetTemplate(abi, "defs")
+	if err != nil {
+		return "", err
+	}
+	return render(name, src, defs, nil)
+}
+
+// RenderPluginInfo 渲染PluginInfo函数模板
+func RenderPluginInfo(abi string, data PluginInfo) (string, error) {
+	src, err := GetTemplate(abi, "pluginInfo")
+	if err != nil {
+		return "", err
+	}
+	return render("pluginInfo", src, "", data)
+}
+
+// PasteCode 将渲染结果中的CodeMarker替换为插件源码，标记必须恰好出现一次
+func PasteCode(rendered string, code string) (string, error) {
+	if n := strings.Count(rendered, CodeMarker); n != 1 {
+		return "", fmt.Errorf("wrapper should contain exactly one code marker, found %d", n)
+	}
+	return strings.Replace(rendered, CodeMarker, code, 1), nil
+}
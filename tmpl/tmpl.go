@@ -7,16 +7,8 @@ import (
 	"strings"
 )
 
-const (
-	PHCustomImports = "/* CUSTOM IMPORTS */"
-	PHCode          = "/* CODE */"
-	PHFormalPara    = "/* FORMAL PARAMETERS */"
-	PHActualPara    = "/* ACTUAL PARAMETERS */"
-	PHPlugInfo      = "/* PLUGIN_INFO */"
-	PHFunName       = "/* FUN_NAME */"
-	PHMinorFunName  = "/* MINOR_FUN_NAME */"
-	PHModuleName    = "/* MODULE_NAME */"
-)
+// PHModuleName gen生成的项目文件中模块名的占位符，包装代码模板则由text/template渲染（见render.go）
+const PHModuleName = "/* MODULE_NAME */"
 
 //go:embed templates/**/*
 var templates embed.FS
@@ -63,7 +55,15 @@ func GetTemplatesDir(dir string) []FileTmpl {
 	return tmpls
 }
 
-func GetTemplate(os, pType string) (string, error) {
+// helperTemplates 追加到包装代码中的辅助模板以及包装模板共用的定义，文件名没有tmpl前缀
+var helperTemplates = map[string]bool{"pluginInfo": true, "argCoerce": true, "recover": true, "lifecycle": true,
+	"defs": true}
+
+// commonTemplates 两种调用方式共用的辅助模板，放在templates/common下，与调用方式有关的部分定义在各自的Defs模板中
+var commonTemplates = map[string]bool{"recover": true, "lifecycle": true}
+
+// GetTemplate 读取模板，abi为插件的调用方式，与templates下的目录名相同（cgo或plugin）
+func GetTemplate(abi, pType string) (string, error) {
 	path := "templates"
 	if strings.Index(pType, "fuzzTypes") == 0 {
 		path = pathJoin(path, pType+".gotmp")
@@ -74,13 +74,15 @@ func GetTemplate(os, pType string) (string, error) {
 		}
 		return string(ft), err
 	}
-	if os == "windows" {
+	if commonTemplates[pType] {
+		path = pathJoin(path, "common")
+	} else if abi == "cgo" {
 		path = pathJoin(path, "cgo")
 	} else {
 		path = pathJoin(path, "plugin")
 	}
 	fileName := strings.Title(pType) + ".gotmp"
-	if pType != "pluginInfo" {
+	if !helperTemplates[pType] {
 		fileName = "tmpl" + fileName
 	}
 	path = pathJoin(path, fileName)
@@ -0,0 +1,166 @@
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FuzzGIUConvention fgpk生成的代码所遵循的FuzzGIU插件约定的版本，应与go.mod中依赖的FuzzGIU版本保持一致
+const FuzzGIUConvention = "0.2.8"
+
+// Semver 语义化版本号
+type Semver struct {
+	Major, Minor, Patch int
+	Pre                 string // 先行版本号，如1.0.0-rc.1中的rc.1
+}
+
+func (v Semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// ParseSemver 解析语义化版本号，允许v前缀，次版本号与修订号可以省略（视为0），构建元数据（+之后的部分）被忽略
+func ParseSemver(s string) (Semver, error) {
+	v := Semver{}
+	raw := s
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, v.Pre, _ = strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || s == "" {
+		return v, fmt.Errorf("invalid version %q", raw)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", raw)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+// comparePre 按语义化版本的规则比较先行版本号，没有先行版本号的版本更大
+func comparePre(a, b string) int {
+	if a == b {
+		return 0
+	} else if a == "" {
+		return 1
+	} else if b == "" {
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case aErr == nil && bErr != nil: // 数字标识符小于非数字标识符
+			return -1
+		case aErr != nil && bErr == nil:
+			return 1
+		case as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// Compare 比较两个版本号，v小于、等于、大于w时分别返回负数、0、正数
+func (v Semver) Compare(w Semver) int {
+	if v.Major != w.Major {
+		return v.Major - w.Major
+	}
+	if v.Minor != w.Minor {
+		return v.Minor - w.Minor
+	}
+	if v.Patch != w.Patch {
+		return v.Patch - w.Patch
+	}
+	return comparePre(v.Pre, w.Pre)
+}
+
+// constraint 版本约束中的一项，如>=0.2.8
+type constraint struct {
+	op  string
+	ver Semver
+}
+
+var constraintOps = []string{">=", "<=", "==", "!=", ">", "<", "="}
+
+func (c constraint) allows(v Semver) bool {
+	cmp := v.Compare(c.ver)
+	switch c.op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	}
+	return cmp == 0
+}
+
+// Requirement 插件对某个组件的版本要求，如fuzzgiu>=0.2.8,<0.3.0
+type Requirement struct {
+	Name        string
+	constraints []constraint
+	raw         string
+}
+
+func (r Requirement) String() string {
+	return r.raw
+}
+
+// ParseRequirement 解析版本要求，组件名之后为逗号分隔的约束，所有约束都满足时才算满足要求
+func ParseRequirement(s string) (Requirement, error) {
+	r := Requirement{raw: strings.TrimSpace(s)}
+	ind := strings.IndexAny(r.raw, "<>=!")
+	if ind <= 0 {
+		return r, fmt.Errorf("invalid requirement %q, expect name followed by constraints, "+
+			"e.g. fuzzgiu>=0.2.8", s)
+	}
+	r.Name = strings.ToLower(strings.TrimSpace(r.raw[:ind]))
+	for _, cs := range strings.Split(r.raw[ind:], ",") {
+		cs = strings.TrimSpace(cs)
+		c := constraint{}
+		for _, op := range constraintOps {
+			if strings.HasPrefix(cs, op) {
+				c.op = op
+				break
+			}
+		}
+		if c.op == "" {
+			return r, fmt.Errorf("invalid constraint %q in requirement %q", cs, s)
+		}
+		var err error
+		if c.ver, err = ParseSemver(strings.TrimSpace(cs[len(c.op):])); err != nil {
+			return r, fmt.Errorf("invalid constraint %q in requirement %q: %w", cs, s, err)
+		}
+		r.constraints = append(r.constraints, c)
+	}
+	return r, nil
+}
+
+// Allows 判断版本是否满足要求
+func (r Requirement) Allows(v Semver) bool {
+	for _, c := range r.constraints {
+		if !c.allows(v) {
+			return false
+		}
+	}
+	return true
+}